@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"cert-manager-webhook-contabo/pkg/solver"
+	"cert-manager-webhook-contabo/pkg/vault"
+)
+
+// webhookFlags holds the flags owned by this binary. Everything else on the
+// command line is passed through to the cert-manager webhook server command.
+type webhookFlags struct {
+	clusterResourceNamespace string
+	secretNamespaceGrants    []string
+	ambientCredentialsDir    string
+	credentialsFilesDir      string
+	dryRun                   bool
+	defaultsFile             string
+	profilesFile             string
+
+	vaultAddr      string
+	vaultRole      string
+	vaultAuthMount string
+	vaultTokenFile string
+	vaultCacheTTL  time.Duration
+
+	ledgerNamespace string
+	gcInterval      time.Duration
+	gcMinAge        time.Duration
+	gcZones         []string
+	gcDryRun        bool
+
+	reconcileOnStartup bool
+
+	leaseLocks     bool
+	leaseNamespace string
+	leaseDuration  time.Duration
+
+	metricsBindAddress string
+
+	auditLog           string
+	auditLogMaxSize    int
+	auditLogMaxBackups int
+	verifyAuditLog     string
+}
+
+func newFlagSet(f *webhookFlags) *pflag.FlagSet {
+	fs := pflag.NewFlagSet("contabo", pflag.ContinueOnError)
+	fs.StringVar(&f.clusterResourceNamespace, "cluster-resource-namespace", "cert-manager",
+		"Namespace cert-manager uses as the resource namespace for ClusterIssuers. Challenges from this namespace may reference credentials Secrets in any namespace.")
+	fs.StringSliceVar(&f.secretNamespaceGrants, "allow-secret-namespace", nil,
+		"Cross-namespace credentials Secret grant in the form ISSUER_NAMESPACE:SECRET_NAMESPACE. ISSUER_NAMESPACE may be '*'. Repeatable.")
+	fs.StringVar(&f.ambientCredentialsDir, "ambient-credentials-dir", "",
+		"Directory holding clientId, clientSecret, username and password files used as ambient credentials for ClusterIssuers. Defaults to the CONTABO_* environment variables when unset.")
+	fs.StringVar(&f.credentialsFilesDir, "credentials-files-dir", "",
+		"Directory ClusterIssuers may read credential files from via the credentials.<field>.file config. File sources are disabled when unset.")
+	fs.StringVar(&f.defaultsFile, "defaults-file", os.Getenv(solver.EnvDefaultsFile),
+		"YAML or JSON file with defaults merged under, and overrides merged over, every Issuer's config. Reloaded when it changes. Defaults to $"+solver.EnvDefaultsFile+".")
+	fs.StringVar(&f.profilesFile, "profiles-file", os.Getenv(solver.EnvProfilesFile),
+		"YAML or JSON file of named solver profiles, each served under its own solverName with its own defaults and overrides. Defaults to $"+solver.EnvProfilesFile+".")
+	fs.BoolVar(&f.dryRun, "dry-run", false,
+		"Only log and record events for the DNS records the webhook would create or delete, for every Issuer. Implies --gc-dry-run.")
+	fs.StringVar(&f.vaultAddr, "vault-addr", "",
+		"Address of the Vault server used by the vault credentials source. The source is disabled when unset.")
+	fs.StringVar(&f.vaultRole, "vault-role", "",
+		"Vault Kubernetes auth role the webhook logs in as.")
+	fs.StringVar(&f.vaultAuthMount, "vault-auth-mount", vault.DefaultAuthMount,
+		"Mount path of the Vault Kubernetes auth method.")
+	fs.StringVar(&f.vaultTokenFile, "vault-token-file", vault.DefaultTokenFile,
+		"Service account token presented to Vault.")
+	fs.DurationVar(&f.vaultCacheTTL, "vault-cache-ttl", vault.DefaultCacheTTL,
+		"How long Vault secrets without a lease are cached.")
+	fs.StringVar(&f.ledgerNamespace, "ledger-namespace", os.Getenv("POD_NAMESPACE"),
+		"Namespace of the ConfigMap recording every TXT record the webhook creates. Defaults to $POD_NAMESPACE; the ledger is disabled when empty.")
+	fs.DurationVar(&f.gcInterval, "gc-interval", 0,
+		"Interval of the garbage collector deleting orphaned ACME TXT records from the ledger. 0 disables it.")
+	fs.DurationVar(&f.gcMinAge, "gc-min-age", time.Hour,
+		"Minimum age of a TXT record before the garbage collector deletes it.")
+	fs.StringSliceVar(&f.gcZones, "gc-zones", nil,
+		"Zones the garbage collector sweeps. Defaults to every zone in the ledger.")
+	fs.BoolVar(&f.gcDryRun, "gc-dry-run", false,
+		"Only report the records the garbage collector would delete.")
+	fs.BoolVar(&f.reconcileOnStartup, "reconcile-on-startup", false,
+		"Re-present TXT records of in-flight Challenges and clean up those of finished Challenges when the webhook starts.")
+	fs.BoolVar(&f.leaseLocks, "lease-locks", false,
+		"Serialise record changes per Contabo account and zone across replicas with coordination.k8s.io Leases.")
+	fs.StringVar(&f.leaseNamespace, "lease-namespace", os.Getenv("POD_NAMESPACE"),
+		"Namespace of the Leases used by --lease-locks. Defaults to $POD_NAMESPACE.")
+	fs.DurationVar(&f.leaseDuration, "lease-duration", solver.DefaultLeaseDuration,
+		"How long a zone lock is held without renewal before another replica may take it over.")
+	fs.StringVar(&f.metricsBindAddress, "metrics-bind-address", ":9402",
+		"Address the Prometheus metrics endpoint listens on. '0' disables it.")
+	fs.StringVar(&f.auditLog, "audit-log", "",
+		"Where every DNS record created or deleted is audited: 'stdout' or the path of a rotated file. Auditing is disabled when unset.")
+	fs.IntVar(&f.auditLogMaxSize, "audit-log-max-size", 100,
+		"Size in megabytes the audit log file grows to before it is rotated.")
+	fs.IntVar(&f.auditLogMaxBackups, "audit-log-max-backups", 10,
+		"Number of rotated audit log files kept.")
+	fs.StringVar(&f.verifyAuditLog, "verify-audit-log", "",
+		"Verify the hash chain of the audit log file at this path, including its rotated files, and exit. For a directory, each audit log in it is verified on its own.")
+	return fs
+}
+
+// parseFlags parses the flags registered on fs out of args and returns the
+// arguments it did not recognise, in their original order.
+func parseFlags(fs *pflag.FlagSet, args []string) ([]string, error) {
+	var own, rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			rest = append(rest, arg)
+			continue
+		}
+
+		name, _, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		flag := fs.Lookup(name)
+		if flag == nil {
+			rest = append(rest, arg)
+			continue
+		}
+
+		own = append(own, arg)
+		if !hasValue && flag.NoOptDefVal == "" && i+1 < len(args) {
+			i++
+			own = append(own, args[i])
+		}
+	}
+
+	if err := fs.Parse(own); err != nil {
+		return nil, err
+	}
+	return rest, nil
+}
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"time"
 
 	cmd "github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
+	// Registers --logging-format=json with the webhook server's logging
+	// flags.
+	_ "k8s.io/component-base/logs/json/register"
 
+	"cert-manager-webhook-contabo/pkg/audit"
+	"cert-manager-webhook-contabo/pkg/metrics"
 	"cert-manager-webhook-contabo/pkg/solver"
+	"cert-manager-webhook-contabo/pkg/tracing"
+	"cert-manager-webhook-contabo/pkg/vault"
 )
 
 func main() {
@@ -14,5 +27,186 @@ func main() {
 		groupName = "acme.contabo.com"
 	}
 
-	cmd.RunWebhookServer(groupName, solver.NewSolver())
+	var flags webhookFlags
+	rest, err := parseFlags(newFlagSet(&flags), os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	os.Args = append(os.Args[:1], rest...)
+
+	if flags.verifyAuditLog != "" {
+		if err := verifyAuditLogs(flags.verifyAuditLog); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	grants, err := solver.ParseNamespaceGrants(flags.secretNamespaceGrants)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	opts := []solver.Option{
+		solver.WithClusterResourceNamespace(flags.clusterResourceNamespace),
+		solver.WithNamespaceGrants(grants...),
+		solver.WithCredentialsFilesDir(flags.credentialsFilesDir),
+	}
+	if flags.ambientCredentialsDir != "" {
+		opts = append(opts, solver.WithAmbientCredentialsDir(flags.ambientCredentialsDir))
+	} else if os.Getenv(solver.EnvClientID) != "" {
+		opts = append(opts, solver.WithAmbientCredentialsFromEnv())
+	}
+	if flags.defaultsFile != "" {
+		defaults, err := solver.LoadDefaultsFile(flags.defaultsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts = append(opts, solver.WithDefaults(flags.defaultsFile, defaults))
+	}
+	if flags.profilesFile != "" {
+		profiles, err := solver.LoadProfilesFile(flags.profilesFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts = append(opts, solver.WithProfiles(flags.profilesFile, profiles...))
+	}
+	if flags.dryRun {
+		opts = append(opts, solver.WithDryRun())
+	}
+	if flags.ledgerNamespace != "" {
+		opts = append(opts, solver.WithLedger(flags.ledgerNamespace))
+	}
+	if flags.gcInterval > 0 {
+		opts = append(opts, solver.WithGarbageCollector(solver.GCOptions{
+			Interval: flags.gcInterval,
+			MinAge:   flags.gcMinAge,
+			Zones:    flags.gcZones,
+			DryRun:   flags.gcDryRun || flags.dryRun,
+		}))
+	}
+	if flags.reconcileOnStartup {
+		opts = append(opts, solver.WithStartupReconciler(groupName))
+	}
+	if flags.leaseLocks {
+		if flags.leaseNamespace == "" {
+			fmt.Fprintln(os.Stderr, "--lease-locks requires --lease-namespace or $POD_NAMESPACE")
+			os.Exit(2)
+		}
+		identity, err := os.Hostname()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts = append(opts, solver.WithLeaseLocks(flags.leaseNamespace, identity, flags.leaseDuration))
+	}
+	if flags.vaultAddr != "" {
+		vaultClient, err := vault.NewClient(flags.vaultAddr, flags.vaultRole, flags.vaultAuthMount, flags.vaultTokenFile, flags.vaultCacheTTL, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts = append(opts, solver.WithVault(vaultClient))
+	}
+	switch flags.auditLog {
+	case "":
+	case "stdout":
+		opts = append(opts, solver.WithAuditSink(audit.NewStdoutLog()))
+	default:
+		auditLog, err := audit.NewFileLog(flags.auditLog, flags.auditLogMaxSize, flags.auditLogMaxBackups)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts = append(opts, solver.WithAuditSink(auditLog))
+	}
+
+	if flags.metricsBindAddress != "0" {
+		listener, err := net.Listen("tcp", flags.metricsBindAddress)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to listen for metrics: %v\n", err)
+			os.Exit(2)
+		}
+		go func() {
+			if err := metrics.Serve(listener, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to serve metrics: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	cmd.RunWebhookServer(groupName, solver.NewSolver(opts...).Solvers()...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to flush traces: %v\n", err)
+	}
+}
+
+// verifyAuditLogs verifies the audit log at path or, if path is a directory,
+// each audit log in it as a chain of its own, and prints the lines verified.
+func verifyAuditLogs(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		n, err := verifyAuditLog(path)
+		if err != nil {
+			return fmt.Errorf("audit log verification failed after %d lines: %w", n, err)
+		}
+		fmt.Printf("verified %d audit log lines\n", n)
+		return nil
+	}
+
+	logs, err := audit.Logs(path)
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		return fmt.Errorf("no audit logs in %s", path)
+	}
+	var errs []error
+	for _, log := range logs {
+		n, err := verifyAuditLog(log)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: audit log verification failed after %d lines: %w", log, n, err))
+			continue
+		}
+		fmt.Printf("%s: verified %d audit log lines\n", log, n)
+	}
+	return errors.Join(errs...)
+}
+
+// verifyAuditLog verifies the audit log at path and its rotated files as one
+// chain and returns the number of lines verified.
+func verifyAuditLog(path string) (int, error) {
+	files, err := audit.Files(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no audit log at %s", path)
+	}
+	readers := make([]io.Reader, 0, len(files))
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	return audit.Verify(io.MultiReader(readers...))
 }
@@ -0,0 +1,312 @@
+// Package audit records every DNS mutation of the webhook as a hash-chained
+// JSON line, so removed or edited lines can be detected with Verify.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Actions.
+const (
+	ActionCreate = "create"
+	ActionDelete = "delete"
+)
+
+// Outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event describes a single create or delete of a DNS record.
+type Event struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Action is ActionCreate or ActionDelete.
+	Action string `json:"action"`
+	// Reason says what triggered the mutation: present, cleanup, stale, gc or
+	// delegation.
+	Reason          string `json:"reason"`
+	ChallengeUID    string `json:"challengeUID,omitempty"`
+	IssuerKind      string `json:"issuerKind,omitempty"`
+	IssuerNamespace string `json:"issuerNamespace,omitempty"`
+	// Credentials says where the credentials used were read from, such as
+	// "secret cert-manager/contabo-credentials".
+	Credentials string `json:"credentials,omitempty"`
+	Zone        string `json:"zone"`
+	RecordName  string `json:"recordName"`
+	RecordType  string `json:"recordType"`
+	RecordID    int64  `json:"recordId,omitempty"`
+	// Outcome is OutcomeSuccess or OutcomeFailure, with Error set.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+	// PrevHash is the hash of the previous line, empty for the first.
+	PrevHash string `json:"prevHash"`
+}
+
+// Sink receives audit events.
+type Sink interface {
+	Record(Event) error
+}
+
+// hashSuffix matches the hash closing every line.
+var hashSuffix = regexp.MustCompile(`,"hash":"([0-9a-f]{64})"}$`)
+
+// Log is a Sink writing hash-chained JSON lines to a writer. Each line ends
+// with "hash", the SHA-256 of the line without it, which includes the
+// previous line's hash as "prevHash".
+type Log struct {
+	mu       sync.Mutex
+	w        io.Writer
+	seq      uint64
+	prevHash string
+}
+
+// NewLog returns a Log writing to w. The chain continues from last, the last
+// line written to w before, if any.
+func NewLog(w io.Writer, last []byte) (*Log, error) {
+	l := &Log{w: w}
+	if len(bytes.TrimSpace(last)) > 0 {
+		event, hash, err := parseLine(last)
+		if err != nil {
+			return nil, fmt.Errorf("cannot continue audit chain: %w", err)
+		}
+		l.seq, l.prevHash = event.Seq, hash
+	}
+	return l, nil
+}
+
+// NewStdoutLog returns a Log writing to standard output. Its chain starts
+// anew with every process.
+func NewStdoutLog() *Log {
+	l, _ := NewLog(os.Stdout, nil)
+	return l
+}
+
+// NewFileLog returns a Log appending to path, rotated once it grows beyond
+// maxSizeMB and keeping maxBackups rotated files. The chain continues from
+// the last line of the file, or of the newest rotated file.
+func NewFileLog(path string, maxSizeMB, maxBackups int) (*Log, error) {
+	last, err := lastLine(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSizeMB,
+		MaxBackups: maxBackups,
+	}
+	return NewLog(w, last)
+}
+
+// Record appends event to the chain. Seq and PrevHash are set by the Log.
+func (l *Log) Record(event Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.Seq = l.seq + 1
+	event.PrevHash = l.prevHash
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC()
+
+	line, hash, err := encodeLine(event)
+	if err != nil {
+		return err
+	}
+	if _, err := l.w.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	l.seq, l.prevHash = event.Seq, hash
+	return nil
+}
+
+func encodeLine(event Event) ([]byte, string, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:])
+	line := append(b[:len(b)-1], fmt.Sprintf(`,"hash":%q}`+"\n", hash)...)
+	return line, hash, nil
+}
+
+// parseLine checks the hash of a single line and returns its event and hash.
+func parseLine(line []byte) (Event, string, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	match := hashSuffix.FindSubmatchIndex(line)
+	if match == nil {
+		return Event{}, "", errors.New("line has no hash")
+	}
+	hash := string(line[match[2]:match[3]])
+	body := append(append([]byte{}, line[:match[0]]...), '}')
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != hash {
+		return Event{}, "", errors.New("hash does not match the line")
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return Event{}, "", err
+	}
+	return event, hash, nil
+}
+
+// Verify checks the chain of the lines read from r, typically the rotated
+// files followed by the current one. It reports the first line that was
+// edited, or that doesn't follow its predecessor because lines were removed,
+// and returns the number of lines verified.
+//
+// The hashes are not keyed, so anyone who can write the log can edit a line
+// and hash the rest of the chain again, and the first line is accepted as
+// is. Verify only proves a log unchanged up to a line whose hash was kept
+// somewhere else.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var (
+		n        int
+		seq      uint64
+		prevHash string
+	)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		n++
+		event, hash, err := parseLine(line)
+		if err != nil {
+			return n - 1, fmt.Errorf("line %d: %w", n, err)
+		}
+		// The first line may continue a chain whose start was rotated away.
+		if n > 1 && (event.Seq != seq+1 || event.PrevHash != prevHash) {
+			return n - 1, fmt.Errorf("line %d: seq %d does not follow seq %d: lines were removed or reordered", n, event.Seq, seq)
+		}
+		seq, prevHash = event.Seq, hash
+	}
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// Files returns the rotated files of the audit log at path, oldest first,
+// followed by path itself, in the order Verify expects them.
+func Files(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+	matches, err := filepath.Glob(globEscape(prefix) + "*" + globEscape(ext))
+	if err != nil {
+		return nil, err
+	}
+	// Other logs in the directory may share the prefix, such as those of
+	// replicas with longer pod names.
+	var backups []string
+	for _, match := range matches {
+		if len(match) == len(prefix)+len(backupTimeFormat)+len(ext) && isBackup(match) {
+			backups = append(backups, match)
+		}
+	}
+	// lumberjack names backups by timestamp, so they sort chronologically.
+	sort.Strings(backups)
+	if _, err := os.Stat(path); err == nil {
+		backups = append(backups, path)
+	}
+	return backups, nil
+}
+
+// Logs returns the audit logs in dir, the .log files that are not rotated
+// files of another, such as the logs of several replicas sharing a volume.
+func Logs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var logs []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.Type().IsRegular() && filepath.Ext(path) == ".log" && !isBackup(path) {
+			logs = append(logs, path)
+		}
+	}
+	return logs, nil
+}
+
+// backupTimeFormat is the timestamp lumberjack adds to rotated files.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// isBackup reports whether path is named like a rotated file.
+func isBackup(path string) bool {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	i := len(base) - len(backupTimeFormat)
+	if i < 1 || base[i-1] != '-' {
+		return false
+	}
+	_, err := time.Parse(backupTimeFormat, base[i:])
+	return err == nil
+}
+
+// lastLine returns the last line of the newest file of the audit log at path.
+func lastLine(path string) ([]byte, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		line, err := lastLineOf(files[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+	return nil, nil
+}
+
+// maxLineSize bounds the tail read by lastLineOf.
+const maxLineSize = 64 * 1024
+
+func lastLineOf(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(info.Size()-maxLineSize, 0)
+	b := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(b, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	b = bytes.TrimRight(b, "\r\n")
+	return b[bytes.LastIndexByte(b, '\n')+1:], nil
+}
+
+func globEscape(s string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`).Replace(s)
+}
@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeEvents(t *testing.T, l *Log, n int) {
+	t.Helper()
+	for i := range n {
+		err := l.Record(Event{
+			Action:     ActionCreate,
+			Reason:     "present",
+			Zone:       "example.com",
+			RecordName: "_acme-challenge",
+			RecordType: "TXT",
+			RecordID:   int64(i + 1),
+			Outcome:    OutcomeSuccess,
+		})
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewLog(&buf, nil)
+	if err != nil {
+		t.Fatalf("new log: %v", err)
+	}
+	writeEvents(t, l, 3)
+
+	if n, err := Verify(bytes.NewReader(buf.Bytes())); err != nil || n != 3 {
+		t.Fatalf("expected 3 verified lines, got %d: %v", n, err)
+	}
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for _, tc := range []struct {
+		name string
+		log  string
+		want string
+	}{
+		{"edited", lines[0] + strings.Replace(lines[1], `"recordId":2`, `"recordId":7`, 1) + lines[2], "line 2: hash does not match"},
+		{"removed", lines[0] + lines[2], "line 2: seq 3 does not follow seq 1"},
+		{"hash removed", lines[0] + `{"seq":2}` + "\n", "line 2: line has no hash"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Verify(strings.NewReader(tc.log))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestFileLogContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for range 2 {
+		l, err := NewFileLog(path, 10, 3)
+		if err != nil {
+			t.Fatalf("new file log: %v", err)
+		}
+		writeEvents(t, l, 2)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if n, err := Verify(bytes.NewReader(b)); err != nil || n != 4 {
+		t.Fatalf("expected 4 verified lines across restarts, got %d: %v", n, err)
+	}
+}
+
+func TestFilesOrdersBackupsFirst(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"audit.log", "audit-2024-02-01T00-00-00.000.log", "audit-2024-01-01T00-00-00.000.log", "other.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	files, err := Files(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("files: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	want := "audit-2024-01-01T00-00-00.000.log audit-2024-02-01T00-00-00.000.log audit.log"
+	if strings.Join(names, " ") != want {
+		t.Fatalf("expected %s, got %v", want, names)
+	}
+}
+
+func TestLogsOfSeveralReplicas(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"webhook-1.log", "webhook-1-2024-01-01T00-00-00.000.log",
+		"webhook-1-b.log", "webhook-1-b-2024-01-01T00-00-00.000.log",
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	logs, err := Logs(dir)
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	var names []string
+	for _, l := range logs {
+		names = append(names, filepath.Base(l))
+	}
+	if want := "webhook-1-b.log webhook-1.log"; strings.Join(names, " ") != want {
+		t.Fatalf("expected %s, got %v", want, names)
+	}
+
+	// The rotated files of one replica don't include another's log.
+	files, err := Files(filepath.Join(dir, "webhook-1.log"))
+	if err != nil {
+		t.Fatalf("files: %v", err)
+	}
+	names = names[:0]
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	if want := "webhook-1-2024-01-01T00-00-00.000.log webhook-1.log"; strings.Join(names, " ") != want {
+		t.Fatalf("expected %s, got %v", want, names)
+	}
+}
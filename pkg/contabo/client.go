@@ -8,15 +8,108 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+
+	"cert-manager-webhook-contabo/pkg/metrics"
+	"cert-manager-webhook-contabo/pkg/tracing"
 )
 
+// RequestIDKey is the span attribute holding the x-request-id sent to
+// Contabo, which Contabo support can look requests up by.
+const RequestIDKey = attribute.Key("contabo.request_id")
+
+// ErrAuthentication is wrapped by errors caused by the token request, such as
+// invalid credentials.
+var ErrAuthentication = errors.New("contabo authentication failed")
+
+// APIError is an error response of the Contabo API. Rate limited requests
+// are not retried: their 429 is returned immediately and counted in
+// metrics.RateLimitedRequests.
+type APIError struct {
+	StatusCode int
+	Status     string
+	// Message is the message of the response body, if any.
+	Message   string
+	RequestID string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("contabo api error: %s (status %d, request id %s)", e.Message, e.StatusCode, e.RequestID)
+	}
+	return fmt.Sprintf("contabo api error: status %s (request id %s)", e.Status, e.RequestID)
+}
+
+// AuthError is a token request rejected by the Contabo identity provider. It
+// wraps ErrAuthentication.
+type AuthError struct {
+	StatusCode int
+	// Code and Description are the OAuth error of the response, such as
+	// invalid_grant.
+	Code        string
+	Description string
+	RequestID   string
+}
+
+func (e *AuthError) Error() string {
+	msg := fmt.Sprintf("%v: %s", ErrAuthentication, e.Rejected())
+	if e.Code != "" {
+		msg += fmt.Sprintf(" (%s: %s", e.Code, e.Description)
+	} else {
+		msg += fmt.Sprintf(" (status %d", e.StatusCode)
+	}
+	return msg + fmt.Sprintf(", request id %s)", e.RequestID)
+}
+
+func (e *AuthError) Unwrap() error {
+	return ErrAuthentication
+}
+
+// ClientRejected reports whether the API client, rather than the user, was
+// rejected.
+func (e *AuthError) ClientRejected() bool {
+	return e.Code == "invalid_client" || e.Code == "unauthorized_client"
+}
+
+// UserRejected reports whether the username or password was rejected.
+func (e *AuthError) UserRejected() bool {
+	return e.Code == "invalid_grant"
+}
+
+// Rejected says which credentials were rejected.
+func (e *AuthError) Rejected() string {
+	switch {
+	case e.ClientRejected():
+		return "the client ID or client secret was rejected"
+	case e.UserRejected():
+		return "the username or password was rejected"
+	default:
+		return "the credentials were rejected"
+	}
+}
+
 const (
 	defaultBaseURL = "https://api.contabo.com"
 	defaultAuthURL = "https://auth.contabo.com/auth/realms/contabo/protocol/openid-connect/token"
+
+	// Endpoint labels of the API request metrics.
+	endpointZones   = "/v1/dns/zones"
+	endpointRecords = "/v1/dns/zones/{zone}/records"
+	endpointRecord  = "/v1/dns/zones/{zone}/records/{id}"
+
+	// zonesPageSize is the page size of ListZones.
+	zonesPageSize = 100
 )
 
 // Client manages authentication and requests to the Contabo DNS API.
@@ -65,7 +158,7 @@ func NewClientWithAuthURL(baseURL, authURL, clientID, secret, username, password
 
 // CreateRecord creates a DNS record within a zone.
 func (c *Client) CreateRecord(ctx context.Context, zone string, req CreateRecordRequest) error {
-	return c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/v1/dns/zones/%s/records", url.PathEscape(zone)), req, nil)
+	return c.doJSON(ctx, http.MethodPost, endpointRecords, fmt.Sprintf("/v1/dns/zones/%s/records", url.PathEscape(zone)), req, nil)
 }
 
 // ListRecords lists DNS records for a zone.
@@ -76,46 +169,56 @@ func (c *Client) ListRecords(ctx context.Context, zone string, search string) ([
 	}
 
 	var resp listRecordsResponse
-	if err := c.doJSON(ctx, http.MethodGet, endpoint, nil, &resp); err != nil {
+	if err := c.doJSON(ctx, http.MethodGet, endpointRecords, endpoint, nil, &resp); err != nil {
 		return nil, err
 	}
 
 	return resp.Data, nil
 }
 
+// ListZones lists the names of the DNS zones of the account.
+func (c *Client) ListZones(ctx context.Context) ([]string, error) {
+	var zones []string
+	for page := 1; ; page++ {
+		var resp listZonesResponse
+		path := fmt.Sprintf("/v1/dns/zones?page=%d&size=%d", page, zonesPageSize)
+		if err := c.doJSON(ctx, http.MethodGet, endpointZones, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, zone := range resp.Data {
+			zones = append(zones, zone.ZoneName)
+		}
+		if page >= resp.Pagination.TotalPages {
+			return zones, nil
+		}
+	}
+}
+
 // DeleteRecord deletes a DNS record by ID. Returns nil if the record is already gone (404).
 func (c *Client) DeleteRecord(ctx context.Context, zone, recordID string) error {
-	return c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/v1/dns/zones/%s/records/%s", url.PathEscape(zone), url.PathEscape(recordID)), nil, nil, http.StatusNotFound)
+	return c.doJSON(ctx, http.MethodDelete, endpointRecord, fmt.Sprintf("/v1/dns/zones/%s/records/%s", url.PathEscape(zone), url.PathEscape(recordID)), nil, nil, http.StatusNotFound)
 }
 
-func (c *Client) doJSON(ctx context.Context, method, path string, reqBody any, out any, acceptStatus ...int) error {
+// doJSON sends a request to path and decodes the response into out. endpoint
+// is path with its parameters left as placeholders, for metrics.
+func (c *Client) doJSON(ctx context.Context, method, endpoint, path string, reqBody any, out any, acceptStatus ...int) error {
 	if err := c.ensureToken(ctx); err != nil {
 		return err
 	}
 
-	var body *bytes.Reader
+	var payload []byte
 	if reqBody != nil {
 		b, err := json.Marshal(reqBody)
 		if err != nil {
 			return err
 		}
-		body = bytes.NewReader(b)
-	} else {
-		body = bytes.NewReader(nil)
+		payload = b
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	requestID := uuid.NewString()
+	resp, err := c.do(ctx, method, endpoint, path, requestID, payload)
 	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+c.accessToken)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-request-id", uuid.NewString())
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
+		return fmt.Errorf("contabo api request %s failed: %w", requestID, err)
 	}
 	defer resp.Body.Close()
 
@@ -125,23 +228,71 @@ func (c *Client) doJSON(ctx context.Context, method, path string, reqBody any, o
 				return nil
 			}
 		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			metrics.RateLimitedRequests.Inc()
+		}
 		var apiErr apiErrorResponse
 		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
-		if apiErr.ErrorMessage != "" {
-			return fmt.Errorf("contabo api error: %s", apiErr.ErrorMessage)
-		}
-		return fmt.Errorf("contabo api error: status %s", resp.Status)
+		return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Message: apiErr.ErrorMessage, RequestID: requestID}
 	}
 
 	if out != nil {
 		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
-			return err
+			return fmt.Errorf("failed to decode contabo api response (request id %s): %w", requestID, err)
 		}
 	}
 
 	return nil
 }
 
+// do sends a single API request with the given x-request-id and records its
+// metrics, span and log line.
+func (c *Client) do(ctx context.Context, method, endpoint, path, requestID string, payload []byte) (*http.Response, error) {
+	ctx, span := tracing.Tracer(ctx).Start(ctx, method+" "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLTemplate(endpoint),
+			RequestIDKey.String(requestID),
+		))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, recordError(span, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-request-id", requestID)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	logger := klog.FromContext(ctx).WithValues("method", method, "path", path, "requestID", requestID)
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	duration := time.Since(start)
+	metrics.APIRequestDuration.WithLabelValues(method, endpoint).Observe(duration.Seconds())
+	if err != nil {
+		logger.V(2).Info("Contabo API request failed", "err", err, "duration", duration)
+		metrics.APIRequests.WithLabelValues(method, endpoint, "error").Inc()
+		return nil, recordError(span, err)
+	}
+	logger.V(4).Info("Contabo API request", "status", resp.StatusCode, "duration", duration)
+	metrics.APIRequests.WithLabelValues(method, endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// recordError marks span as failed with err and returns err.
+func recordError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
 func (c *Client) ensureToken(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -149,6 +300,21 @@ func (c *Client) ensureToken(ctx context.Context) error {
 	if c.accessToken != "" && time.Until(c.expiresAt) > 30*time.Second {
 		return nil
 	}
+	return c.fetchToken(ctx)
+}
+
+// fetchToken requests a new access token. The caller must hold c.mu.
+func (c *Client) fetchToken(ctx context.Context) (err error) {
+	requestID := uuid.NewString()
+	ctx, span := tracing.Tracer(ctx).Start(ctx, "contabo.FetchToken",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(RequestIDKey.String(requestID)))
+	defer func() {
+		if err != nil {
+			recordError(span, err)
+		}
+		span.End()
+	}()
 
 	form := url.Values{}
 	form.Set("client_id", c.clientID)
@@ -163,26 +329,41 @@ func (c *Client) ensureToken(ctx context.Context) error {
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("x-request-id", uuid.NewString())
+	req.Header.Set("x-request-id", requestID)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultError).Inc()
+		return fmt.Errorf("contabo token request %s failed: %w", requestID, err)
 	}
 	defer resp.Body.Close()
 
+	klog.FromContext(ctx).V(4).Info("Contabo token request", "requestID", requestID, "status", resp.StatusCode)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("token request failed: status %s", resp.Status)
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultError).Inc()
+		// Only rejected credentials are authentication errors; an outage
+		// of the identity provider is an API error like any other.
+		if resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnauthorized {
+			return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, RequestID: requestID}
+		}
+		var oauthErr oauthErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&oauthErr)
+		return &AuthError{StatusCode: resp.StatusCode, Code: oauthErr.Error, Description: oauthErr.Description, RequestID: requestID}
 	}
 
 	var token tokenResponse
 	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultError).Inc()
 		return err
 	}
 
 	if token.AccessToken == "" {
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultError).Inc()
 		return errors.New("token response missing access_token")
 	}
+	metrics.TokenRefreshes.WithLabelValues(metrics.ResultSuccess).Inc()
 
 	c.accessToken = token.AccessToken
 	c.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
@@ -196,10 +377,24 @@ type tokenResponse struct {
 	ExpiresIn   int    `json:"expires_in"`
 }
 
+type oauthErrorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
 type apiErrorResponse struct {
 	ErrorMessage string `json:"message"`
 }
 
+type listZonesResponse struct {
+	Data []struct {
+		ZoneName string `json:"zoneName"`
+	} `json:"data"`
+	Pagination struct {
+		TotalPages int `json:"totalPages"`
+	} `json:"_pagination"`
+}
+
 type listRecordsResponse struct {
 	Data []DNSRecord `json:"data"`
 }
@@ -3,6 +3,7 @@ package contabo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +11,14 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"cert-manager-webhook-contabo/pkg/metrics"
 )
 
 func TestClientCreateListDelete(t *testing.T) {
@@ -125,3 +134,155 @@ func TestClientListRecordsSearchParam(t *testing.T) {
 		t.Fatalf("list records: %v", err)
 	}
 }
+
+func TestClientCountsRateLimitedRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token123","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/dns/zones/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := NewClientWithAuthURL(server.URL, server.URL+"/token", "id", "secret", "user", "pass", 5*time.Second)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	limited := testutil.ToFloat64(metrics.RateLimitedRequests)
+	err = client.CreateRecord(context.Background(), "example.com", CreateRecordRequest{Name: "_acme-challenge", Type: "TXT", Data: "value"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected a 429 API error, got %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.RateLimitedRequests) - limited; got != 1 {
+		t.Fatalf("expected 1 rate limited request, got %v", got)
+	}
+}
+
+func TestClientSpansCarryRequestID(t *testing.T) {
+	var requestIDs []string
+	var traceparent string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		requestIDs = append(requestIDs, r.Header.Get("x-request-id"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token123","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/dns/zones/example.com/records/42", func(w http.ResponseWriter, r *http.Request) {
+		requestIDs = append(requestIDs, r.Header.Get("x-request-id"))
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := NewClientWithAuthURL(server.URL, server.URL+"/token", "id", "secret", "user", "pass", 5*time.Second)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	if err := client.DeleteRecord(ctx, "example.com", "42"); err != nil {
+		t.Fatalf("delete record: %v", err)
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected token, delete and parent spans, got %d", len(spans))
+	}
+	for i, name := range []string{"contabo.FetchToken", "DELETE " + endpointRecord} {
+		span := spans[i]
+		if span.Name != name || span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("expected %s as a child of the parent span, got %s", name, span.Name)
+		}
+		var requestID string
+		for _, attr := range span.Attributes {
+			if attr.Key == RequestIDKey {
+				requestID = attr.Value.AsString()
+			}
+		}
+		if requestID == "" || requestID != requestIDs[i] {
+			t.Fatalf("expected span %s to carry request ID %q, got %q", name, requestIDs[i], requestID)
+		}
+	}
+
+	if want := "00-" + parent.SpanContext().TraceID().String(); !strings.HasPrefix(traceparent, want) {
+		t.Fatalf("expected traceparent %s-..., got %q", want, traceparent)
+	}
+}
+
+func TestClientTokenErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		auth   bool
+		want   string
+	}{
+		{"client rejected", http.StatusUnauthorized, `{"error":"unauthorized_client","error_description":"Invalid client secret"}`, true, "the client ID or client secret was rejected"},
+		{"user rejected", http.StatusUnauthorized, `{"error":"invalid_grant","error_description":"Invalid user credentials"}`, true, "the username or password was rejected"},
+		{"no body", http.StatusBadRequest, ``, true, "the credentials were rejected (status 400"},
+		{"outage", http.StatusServiceUnavailable, ``, false, "contabo api error: status 503 Service Unavailable"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			t.Cleanup(server.Close)
+
+			client, err := NewClientWithAuthURL(server.URL, server.URL+"/token", "id", "secret", "user", "pass", 5*time.Second)
+			if err != nil {
+				t.Fatalf("new client: %v", err)
+			}
+			_, err = client.ListRecords(context.Background(), "example.com", "")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+			if errors.Is(err, ErrAuthentication) != tc.auth {
+				t.Fatalf("expected authentication error to be %v, got %v", tc.auth, err)
+			}
+		})
+	}
+}
+
+func TestClientListZonesPages(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token123","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/dns/zones", func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"zoneName":"zone` + page + `.example"}],"_pagination":{"totalPages":2}}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := NewClientWithAuthURL(server.URL, server.URL+"/token", "id", "secret", "user", "pass", 5*time.Second)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	zones, err := client.ListZones(context.Background())
+	if err != nil {
+		t.Fatalf("list zones: %v", err)
+	}
+	if strings.Join(zones, ",") != "zone1.example,zone2.example" {
+		t.Fatalf("unexpected zones: %v", zones)
+	}
+}
@@ -0,0 +1,150 @@
+// Package metrics defines the webhook's Prometheus metrics and serves them on
+// a dedicated port.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+)
+
+const namespace = "contabo_webhook"
+
+// Result label values.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+var (
+	// Registry holds every metric of the webhook. It is separate from the
+	// default registry so the metrics endpoint doesn't pick up the
+	// cert-manager webhook server's internals.
+	Registry = prometheus.NewRegistry()
+
+	// Operations counts Present and CleanUp calls by operation, zone and
+	// result.
+	Operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Present and CleanUp calls by operation, zone and result.",
+	}, []string{"operation", "zone", "result"})
+
+	// OperationDuration observes the latency of Present and CleanUp calls.
+	OperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of Present and CleanUp calls by operation, zone and result.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"operation", "zone", "result"})
+
+	// OperationErrors counts failed Present and CleanUp calls by operation
+	// and error class.
+	OperationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operation_errors_total",
+		Help:      "Failed Present and CleanUp calls by operation and error class.",
+	}, []string{"operation", "class"})
+
+	// APIRequests counts Contabo API requests by method, endpoint and status
+	// code. The code is "error" when no response was received.
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Contabo API requests by method, endpoint and status code.",
+	}, []string{"method", "endpoint", "code"})
+
+	// APIRequestDuration observes the latency of Contabo API requests.
+	APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of Contabo API requests by method and endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint"})
+
+	// TokenRefreshes counts OAuth token requests by result.
+	TokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "Contabo OAuth token requests by result.",
+	}, []string{"result"})
+
+	// RateLimitedRequests counts the Contabo API requests answered with 429.
+	RateLimitedRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Contabo API requests rejected with 429 Too Many Requests.",
+	})
+
+	// ManagedRecords is the number of ACME TXT records in the ledger by zone.
+	ManagedRecords = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_records",
+		Help:      "ACME TXT records currently managed by the webhook, from its ledger.",
+	}, []string{"zone"})
+
+	// DefaultsReloads counts reloads of the defaults of each solver by result.
+	DefaultsReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "defaults_reloads_total",
+		Help:      "Reloads of the defaults of each solver by result. Failed reloads keep the previous defaults.",
+	}, []string{"solver", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Operations,
+		OperationDuration,
+		OperationErrors,
+		APIRequests,
+		APIRequestDuration,
+		TokenRefreshes,
+		RateLimitedRequests,
+		ManagedRecords,
+		DefaultsReloads,
+	)
+}
+
+// Result returns the result label for err.
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
+
+// ObserveOperation records a Present or CleanUp call that started at start.
+func ObserveOperation(operation, zone string, start time.Time, err error) {
+	result := Result(err)
+	Operations.WithLabelValues(operation, zone, result).Inc()
+	OperationDuration.WithLabelValues(operation, zone, result).Observe(time.Since(start).Seconds())
+}
+
+// Serve exposes the metrics at /metrics on listener until stopCh is closed.
+func Serve(listener net.Listener, stopCh <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	klog.Infof("serving metrics on %s", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
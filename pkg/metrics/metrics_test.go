@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeExposesMetrics(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	stopCh := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- Serve(listener, stopCh) }()
+
+	ObserveOperation("Present", "example.com", time.Now(), errors.New("failed"))
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("get metrics: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	want := `contabo_webhook_operations_total{operation="Present",result="error",zone="example.com"} 1`
+	if !strings.Contains(string(body), want) {
+		t.Fatalf("expected %q in metrics, got:\n%s", want, body)
+	}
+
+	close(stopCh)
+	if err := <-done; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+}
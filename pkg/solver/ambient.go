@@ -0,0 +1,86 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// Environment variables read by WithAmbientCredentialsFromEnv.
+const (
+	EnvClientID     = "CONTABO_CLIENT_ID"
+	EnvClientSecret = "CONTABO_CLIENT_SECRET"
+	EnvUsername     = "CONTABO_USERNAME"
+	EnvPassword     = "CONTABO_PASSWORD"
+)
+
+// WithAmbientCredentialsFromEnv makes the CONTABO_* environment variables of
+// the webhook process available as ambient credentials.
+func WithAmbientCredentialsFromEnv() Option {
+	return func(s *Solver) {
+		s.ambient = func() (*credentials, error) {
+			return newAmbientCredentials("environment",
+				os.Getenv(EnvClientID), os.Getenv(EnvClientSecret), os.Getenv(EnvUsername), os.Getenv(EnvPassword))
+		}
+	}
+}
+
+// WithAmbientCredentialsDir makes credentials mounted into dir available as
+// ambient credentials. The directory uses the same file names as the keys of
+// a credentials Secret, so a Secret volume can be mounted as is. Files are
+// re-read on every use to pick up rotated credentials.
+func WithAmbientCredentialsDir(dir string) Option {
+	return func(s *Solver) {
+		s.ambient = func() (*credentials, error) {
+			values := make(map[string]string, 4)
+			for _, key := range []string{secretKeyClientID, secretKeyClientSecret, secretKeyUsername, secretKeyPassword} {
+				b, err := os.ReadFile(filepath.Join(dir, key))
+				if err != nil && !os.IsNotExist(err) {
+					return nil, fmt.Errorf("failed to read ambient credentials: %w", err)
+				}
+				values[key] = string(b)
+			}
+			return newAmbientCredentials(dir,
+				values[secretKeyClientID], values[secretKeyClientSecret], values[secretKeyUsername], values[secretKeyPassword])
+		}
+	}
+}
+
+func newAmbientCredentials(source, clientID, clientSecret, username, password string) (*credentials, error) {
+	creds := &credentials{
+		clientID:     strings.TrimSpace(clientID),
+		clientSecret: strings.TrimSpace(clientSecret),
+		username:     strings.TrimSpace(username),
+		password:     strings.TrimSpace(password),
+		source:       "ambient " + source,
+	}
+	if creds.clientID == "" || creds.clientSecret == "" || creds.username == "" || creds.password == "" {
+		return nil, fmt.Errorf("ambient credentials from %s are incomplete: client ID, client secret, username and password are required", source)
+	}
+	return creds, nil
+}
+
+// ambientSource returns the webhook's own credentials for challenges that
+// don't configure any. Only ClusterIssuers with ambient credentials enabled in
+// cert-manager may use them.
+type ambientSource struct {
+	solver *Solver
+}
+
+func (src *ambientSource) load(_ context.Context, ch *v1alpha1.ChallengeRequest) (*credentials, error) {
+	s := src.solver
+	if !ch.AllowAmbientCredentials {
+		return nil, fmt.Errorf("credentialsSecretName is required: ambient credentials are not allowed for this issuer")
+	}
+	if !s.isClusterIssuer(ch) {
+		return nil, fmt.Errorf("credentialsSecretName is required: ambient credentials may only be used by ClusterIssuers")
+	}
+	if s.ambient == nil {
+		return nil, fmt.Errorf("credentialsSecretName is required: the webhook has no ambient credentials configured")
+	}
+	return s.ambient()
+}
@@ -0,0 +1,72 @@
+package solver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestLoadAmbientCredentials(t *testing.T) {
+	t.Setenv(EnvClientID, "id")
+	t.Setenv(EnvClientSecret, "secret")
+	t.Setenv(EnvUsername, "user")
+	t.Setenv(EnvPassword, "pass")
+
+	s := NewSolver(WithAmbientCredentialsFromEnv())
+	cfg := &Config{}
+
+	clusterIssuer := &v1alpha1.ChallengeRequest{ResourceNamespace: DefaultClusterResourceNamespace, AllowAmbientCredentials: true}
+	creds, err := s.loadCredentials(context.Background(), clusterIssuer, cfg)
+	if err != nil {
+		t.Fatalf("load ambient credentials: %v", err)
+	}
+	if creds.clientID != "id" || creds.password != "pass" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+
+	notAllowed := &v1alpha1.ChallengeRequest{ResourceNamespace: DefaultClusterResourceNamespace}
+	if _, err := s.loadCredentials(context.Background(), notAllowed, cfg); err == nil {
+		t.Fatalf("expected error when ambient credentials are not allowed")
+	}
+
+	namespacedIssuer := &v1alpha1.ChallengeRequest{ResourceNamespace: "tenant-ns", AllowAmbientCredentials: true}
+	if _, err := s.loadCredentials(context.Background(), namespacedIssuer, cfg); err == nil {
+		t.Fatalf("expected error for namespaced issuer")
+	}
+
+	if _, err := NewSolver().loadCredentials(context.Background(), clusterIssuer, cfg); err == nil {
+		t.Fatalf("expected error when no ambient credentials are configured")
+	}
+}
+
+func TestAmbientCredentialsDir(t *testing.T) {
+	dir := t.TempDir()
+	for key, value := range map[string]string{
+		secretKeyClientID:     "id\n",
+		secretKeyClientSecret: "secret\n",
+		secretKeyUsername:     "user\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, key), []byte(value), 0o600); err != nil {
+			t.Fatalf("write %s: %v", key, err)
+		}
+	}
+
+	s := NewSolver(WithAmbientCredentialsDir(dir))
+	if _, err := s.ambient(); err == nil {
+		t.Fatalf("expected error for missing password file")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, secretKeyPassword), []byte("pass"), 0o600); err != nil {
+		t.Fatalf("write password: %v", err)
+	}
+	creds, err := s.ambient()
+	if err != nil {
+		t.Fatalf("load ambient credentials: %v", err)
+	}
+	if creds.clientID != "id" || creds.clientSecret != "secret" || creds.username != "user" || creds.password != "pass" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+}
@@ -0,0 +1,56 @@
+package solver
+
+import (
+	"context"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+
+	"cert-manager-webhook-contabo/pkg/audit"
+)
+
+// Reasons recorded with audit events.
+const (
+	auditReasonPresent    = "present"
+	auditReasonCleanUp    = "cleanup"
+	auditReasonStale      = "stale"
+	auditReasonGC         = "gc"
+	auditReasonDelegation = "delegation"
+)
+
+// WithAuditSink records every DNS record the webhook creates or deletes, and
+// every attempt that failed, in sink.
+func WithAuditSink(sink audit.Sink) Option {
+	return func(s *Solver) {
+		s.auditSink = sink
+	}
+}
+
+// recordAudit records a create or delete of a record in zone for ch. err is
+// the error of the Contabo API call, if any. A sink that fails to record the
+// event is logged but doesn't fail the operation, which already happened.
+func (s *Solver) recordAudit(ctx context.Context, ch *v1alpha1.ChallengeRequest, creds *credentials, action, reason, zone, recordName, recordType string, recordID int64, err error) {
+	if s.auditSink == nil {
+		return
+	}
+	event := audit.Event{
+		Action:          action,
+		Reason:          reason,
+		ChallengeUID:    string(ch.UID),
+		IssuerKind:      s.issuerKind(ch),
+		IssuerNamespace: ch.ResourceNamespace,
+		Credentials:     creds.source,
+		Zone:            zone,
+		RecordName:      recordName,
+		RecordType:      recordType,
+		RecordID:        recordID,
+		Outcome:         audit.OutcomeSuccess,
+	}
+	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event.Error = err.Error()
+	}
+	if err := s.auditSink.Record(event); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to record audit event", "action", action, "recordName", recordName, "recordID", recordID)
+	}
+}
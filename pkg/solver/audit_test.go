@@ -0,0 +1,100 @@
+package solver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"cert-manager-webhook-contabo/pkg/audit"
+)
+
+// memorySink is an audit.Sink keeping events in memory.
+type memorySink struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (m *memorySink) Record(event audit.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+func TestAuditRecordsCreateAndDelete(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	sink := &memorySink{}
+	WithAuditSink(sink)(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("expected 2 audit events, got %+v", sink.events)
+	}
+	created, deleted := sink.events[0], sink.events[1]
+	if created.Action != audit.ActionCreate || created.Reason != auditReasonPresent || deleted.Action != audit.ActionDelete || deleted.Reason != auditReasonCleanUp {
+		t.Fatalf("unexpected actions: %+v", sink.events)
+	}
+	for _, event := range sink.events {
+		if event.Outcome != audit.OutcomeSuccess || event.ChallengeUID != "challenge-uid" || event.IssuerKind != "Issuer" ||
+			event.IssuerNamespace != "tenant-ns" || event.Credentials != "secret tenant-ns/contabo-credentials" ||
+			event.Zone != "example.com" || event.RecordName != "_acme-challenge" || event.RecordType != "TXT" {
+			t.Fatalf("unexpected audit event: %+v", event)
+		}
+	}
+	if created.RecordID == 0 || created.RecordID != deleted.RecordID {
+		t.Fatalf("expected both events to name the same record, got %d and %d", created.RecordID, deleted.RecordID)
+	}
+}
+
+func TestAuditRecordsFailures(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	// Lists are answered by f, creates fail.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.server.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(failing.Close)
+	s, ch := newTestSolver(t, f, func(cfg *Config) { cfg.BaseURL = failing.URL })
+	sink := &memorySink{}
+	WithAuditSink(sink)(s)
+
+	if err := s.Present(ch); err == nil {
+		t.Fatalf("expected present to fail")
+	}
+	if len(sink.events) != 1 || sink.events[0].Outcome != audit.OutcomeFailure || sink.events[0].Error == "" {
+		t.Fatalf("expected a failed create, got %+v", sink.events)
+	}
+}
+
+func TestAuditLogChainsSolverEvents(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	var buf bytes.Buffer
+	log, err := audit.NewLog(&buf, nil)
+	if err != nil {
+		t.Fatalf("new log: %v", err)
+	}
+	WithAuditSink(log)(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if n, err := audit.Verify(&buf); err != nil || n != 2 {
+		t.Fatalf("expected 2 verified lines, got %d: %v", n, err)
+	}
+}
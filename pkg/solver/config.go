@@ -0,0 +1,271 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/json"
+)
+
+// ConfigVersionV1 is the only apiVersion of Config. Configs without an
+// apiVersion are read as this version.
+const ConfigVersionV1 = "v1"
+
+const (
+	defaultTTL     = 120
+	defaultTimeout = 15 * time.Second
+
+	// Bounds of ttl and timeoutSeconds. Contabo rejects TTLs outside of
+	// minTTL and maxTTL, and cert-manager gives up on Present long before
+	// maxTimeoutSecs.
+	minTTL         = 60
+	maxTTL         = 86400
+	maxTimeoutSecs = 300
+)
+
+// configPath is the root of the field paths in config errors, the webhook
+// config of the Issuer's solver.
+var configPath = field.NewPath("config")
+
+// loadConfig decodes the webhook config of an Issuer, rejecting unknown and
+// duplicate fields, merges it with the defaults of the profile in ctx, defaults it
+// and validates it. Every problem found is reported in a single error.
+func (s *Solver) loadConfig(ctx context.Context, rawJSON *apiextensionsv1.JSON) (*Config, error) {
+	if rawJSON == nil {
+		return nil, fmt.Errorf("config is required")
+	}
+
+	var cfg Config
+	strictErrs, err := json.UnmarshalStrict(rawJSON.Raw, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	var errs field.ErrorList
+	for _, strictErr := range strictErrs {
+		errs = append(errs, strictError(configPath, strictErr))
+	}
+	if defaults := s.profileFrom(ctx).defaults.Load(); defaults != nil {
+		merged, err := defaults.apply(rawJSON.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge config with defaults: %w", err)
+		}
+		// Unknown fields were reported above, and the defaults file was
+		// checked when it was loaded.
+		cfg = Config{}
+		if err := json.UnmarshalCaseSensitivePreserveInts(merged, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+	}
+	cfg.setDefaults()
+	errs = append(errs, cfg.validate(configPath)...)
+	// Without the ledger a deferred deletion only lives in memory, and a
+	// restart would leave the record behind.
+	if cfg.CleanupDelay != nil && cfg.CleanupDelay.Duration > 0 && s.ledger == nil {
+		errs = append(errs, field.Forbidden(configPath.Child("cleanupDelay"), "requires the webhook's record ledger to be enabled"))
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config: %w", errs.ToAggregate())
+	}
+	return &cfg, nil
+}
+
+// strictError turns an unknown or duplicate field reported by
+// json.UnmarshalStrict into a field error below root.
+func strictError(root *field.Path, err error) *field.Error {
+	fieldErr, ok := err.(json.FieldError)
+	if !ok {
+		return field.Invalid(root, nil, err.Error())
+	}
+	path := field.NewPath(fieldErr.FieldPath())
+	if root != nil {
+		path = root.Child(fieldErr.FieldPath())
+	}
+	if strings.Contains(err.Error(), "duplicate field") {
+		return field.Duplicate(path, fieldErr.FieldPath())
+	}
+	return field.Forbidden(path, "unknown field")
+}
+
+// setDefaults fills in the fields an Issuer may leave out.
+func (c *Config) setDefaults() {
+	if c.APIVersion == "" {
+		c.APIVersion = ConfigVersionV1
+	}
+	if c.TTL == 0 {
+		c.TTL = defaultTTL
+	}
+	if c.TimeoutSecs == 0 {
+		c.TimeoutSecs = int(defaultTimeout / time.Second)
+	}
+	if c.PropagationCheck != nil {
+		if c.PropagationCheck.TimeoutSecs == 0 {
+			c.PropagationCheck.TimeoutSecs = int(defaultPropagationTimeout / time.Second)
+		}
+		if c.PropagationCheck.IntervalSecs == 0 {
+			c.PropagationCheck.IntervalSecs = int(defaultPropagationInterval / time.Second)
+		}
+	}
+	if c.VerifyChanges != nil {
+		if c.VerifyChanges.TimeoutSecs == 0 {
+			c.VerifyChanges.TimeoutSecs = int(defaultVerifyTimeout / time.Second)
+		}
+		if c.VerifyChanges.IntervalSecs == 0 {
+			c.VerifyChanges.IntervalSecs = int(defaultVerifyInterval / time.Second)
+		}
+	}
+	if c.StaleRecords != nil && c.StaleRecords.Action == "" {
+		c.StaleRecords.Action = StaleRecordsKeep
+	}
+}
+
+// validate checks a defaulted config.
+func (c *Config) validate(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if c.APIVersion != ConfigVersionV1 {
+		errs = append(errs, field.NotSupported(fldPath.Child("apiVersion"), c.APIVersion, []string{ConfigVersionV1}))
+	}
+
+	errs = append(errs, c.validateCredentials(fldPath)...)
+	errs = append(errs, validateURL(fldPath.Child("baseUrl"), c.BaseURL)...)
+	errs = append(errs, validateURL(fldPath.Child("authUrl"), c.AuthURL)...)
+	if c.TTL < minTTL || c.TTL > maxTTL {
+		errs = append(errs, field.Invalid(fldPath.Child("ttl"), c.TTL, fmt.Sprintf("must be between %d and %d seconds", minTTL, maxTTL)))
+	}
+	if c.TimeoutSecs < 1 || c.TimeoutSecs > maxTimeoutSecs {
+		errs = append(errs, field.Invalid(fldPath.Child("timeoutSeconds"), c.TimeoutSecs, fmt.Sprintf("must be between 1 and %d", maxTimeoutSecs)))
+	}
+	if c.PropagationCheck != nil {
+		errs = append(errs, validatePolling(fldPath.Child("propagationCheck"), c.PropagationCheck.TimeoutSecs, c.PropagationCheck.IntervalSecs, maxPropagationTimeoutSecs, c.PropagationCheck.timeout())...)
+	}
+	if c.VerifyChanges != nil {
+		errs = append(errs, validatePolling(fldPath.Child("verifyChanges"), c.VerifyChanges.TimeoutSecs, c.VerifyChanges.IntervalSecs, maxVerifyTimeoutSecs, c.VerifyChanges.timeout())...)
+	}
+	if c.CleanupDelay != nil && c.CleanupDelay.Duration < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("cleanupDelay"), c.CleanupDelay.Duration.String(), "must not be negative"))
+	}
+	errs = append(errs, c.StaleRecords.validate(fldPath.Child("staleRecords"))...)
+	if c.Delegation != nil && c.Delegation.ValidationZone == "" {
+		errs = append(errs, field.Required(fldPath.Child("delegation", "validationZone"), ""))
+	}
+	return errs
+}
+
+// validateCredentials checks that at most one credentials source is set and
+// that the one set is complete. None at all is valid for ClusterIssuers
+// using ambient credentials.
+func (c *Config) validateCredentials(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	var set []string
+	for _, source := range []struct {
+		name string
+		set  bool
+	}{
+		{"credentialsSecretName", c.CredentialsSecretName != ""},
+		{"credentialsSecretRef", c.CredentialsSecretRef != nil},
+		{"credentials", c.Credentials != nil},
+		{"vault", c.Vault != nil},
+	} {
+		if !source.set {
+			continue
+		}
+		if len(set) > 0 {
+			errs = append(errs, field.Forbidden(fldPath.Child(source.name), fmt.Sprintf("may not be set together with %s", strings.Join(set, " and "))))
+		}
+		set = append(set, source.name)
+	}
+
+	if c.CredentialsSecretRef != nil && c.CredentialsSecretRef.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("credentialsSecretRef", "name"), ""))
+	}
+	if c.Credentials != nil {
+		credsPath := fldPath.Child("credentials")
+		errs = append(errs, c.Credentials.ClientID.validate(credsPath.Child("clientId"))...)
+		errs = append(errs, c.Credentials.ClientSecret.validate(credsPath.Child("clientSecret"))...)
+		errs = append(errs, c.Credentials.Username.validate(credsPath.Child("username"))...)
+		errs = append(errs, c.Credentials.Password.validate(credsPath.Child("password"))...)
+	}
+	if c.Vault != nil && c.Vault.Path == "" {
+		errs = append(errs, field.Required(fldPath.Child("vault", "path"), ""))
+	}
+	return errs
+}
+
+func (v *ValueSource) validate(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case v.SecretKeyRef != nil && v.File != "":
+		errs = append(errs, field.Forbidden(fldPath.Child("file"), "may not be set together with secretKeyRef"))
+	case v.SecretKeyRef != nil:
+		if v.SecretKeyRef.Name == "" {
+			errs = append(errs, field.Required(fldPath.Child("secretKeyRef", "name"), ""))
+		}
+		if v.SecretKeyRef.Key == "" {
+			errs = append(errs, field.Required(fldPath.Child("secretKeyRef", "key"), ""))
+		}
+	case v.File == "":
+		errs = append(errs, field.Required(fldPath, "one of secretKeyRef or file is required"))
+	}
+	return errs
+}
+
+// validateURL checks an optional API URL.
+func validateURL(fldPath *field.Path, value string) field.ErrorList {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, err.Error())}
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be an absolute http or https URL")}
+	}
+	return nil
+}
+
+// validatePolling checks the timeout and interval of a defaulted polling
+// config. The interval must not exceed timeout, the timeout in effect, which
+// is the default one when timeoutSecs is unset.
+func validatePolling(fldPath *field.Path, timeoutSecs, intervalSecs, maxTimeoutSecs int, timeout time.Duration) field.ErrorList {
+	var errs field.ErrorList
+	if timeoutSecs < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("timeoutSeconds"), timeoutSecs, "must not be negative"))
+	} else if timeoutSecs > maxTimeoutSecs {
+		errs = append(errs, field.Invalid(fldPath.Child("timeoutSeconds"), timeoutSecs, fmt.Sprintf("must not exceed %d", maxTimeoutSecs)))
+	}
+	if intervalSecs < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("intervalSeconds"), intervalSecs, "must not be negative"))
+	} else if limit := int(timeout / time.Second); intervalSecs > limit {
+		errs = append(errs, field.Invalid(fldPath.Child("intervalSeconds"), intervalSecs, fmt.Sprintf("must not exceed timeoutSeconds (%d)", limit)))
+	}
+	return errs
+}
+
+func (c *Config) ttl() int {
+	if c.TTL <= 0 {
+		return defaultTTL
+	}
+	return c.TTL
+}
+
+func (c *Config) timeout() time.Duration {
+	if c.TimeoutSecs <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(c.TimeoutSecs) * time.Second
+}
+
+// operationTimeout bounds the API calls of one Present or CleanUp together
+// with the verification of their changes.
+func (c *Config) operationTimeout() time.Duration {
+	if c.VerifyChanges == nil {
+		return c.timeout()
+	}
+	return c.timeout() + c.VerifyChanges.timeout()
+}
@@ -0,0 +1,99 @@
+package solver
+
+import (
+	"strings"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: []byte(`{"credentialsSecretName":"creds","verifyChanges":{}}`)})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.APIVersion != ConfigVersionV1 || cfg.TTL != defaultTTL || cfg.TimeoutSecs != 15 {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.VerifyChanges.TimeoutSecs == 0 || cfg.VerifyChanges.IntervalSecs == 0 {
+		t.Fatalf("expected verifyChanges to be defaulted, got %+v", cfg.VerifyChanges)
+	}
+}
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+	raw := `{
+		"apiVersion": "v2",
+		"credentialSecretName": "creds",
+		"ttlSeconds": 300,
+		"baseUrl": "api.contabo.com",
+		"ttl": 5,
+		"timeoutSeconds": 900,
+		"propagationCheck": {"timeoutSeconds": 5, "intervalSeconds": 10},
+		"verifyChanges": {"timeoutSeconds": 900},
+		"staleRecords": {"action": "Purge"},
+		"delegation": {"validationZone": "", "ensureCname": true}
+	}`
+	_, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: []byte(raw)})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, want := range []string{
+		`config.apiVersion: Unsupported value: "v2"`,
+		"config.credentialSecretName: Forbidden: unknown field",
+		"config.ttlSeconds: Forbidden: unknown field",
+		"config.delegation.ensureCname: Forbidden: unknown field",
+		`config.baseUrl: Invalid value: "api.contabo.com"`,
+		"config.ttl: Invalid value: 5",
+		"config.timeoutSeconds: Invalid value: 900",
+		"config.propagationCheck.intervalSeconds: Invalid value: 10",
+		"config.verifyChanges.timeoutSeconds: Invalid value: 900: must not exceed 30",
+		`config.staleRecords.action: Unsupported value: "Purge"`,
+		"config.delegation.validationZone: Required value",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigBoundsTimeouts(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want string
+	}{
+		{`{"timeoutSeconds":-1}`, "config.timeoutSeconds: Invalid value: -1: must be between 1 and 300"},
+		{`{"timeoutSeconds":301}`, "config.timeoutSeconds: Invalid value: 301: must be between 1 and 300"},
+		{`{"propagationCheck":{"timeoutSeconds":-1}}`, "config.propagationCheck.timeoutSeconds: Invalid value: -1: must not be negative"},
+		{`{"propagationCheck":{"timeoutSeconds":60}}`, "config.propagationCheck.timeoutSeconds: Invalid value: 60: must not exceed 30"},
+		{`{"propagationCheck":{"intervalSeconds":-1}}`, "config.propagationCheck.intervalSeconds: Invalid value: -1: must not be negative"},
+		{`{"propagationCheck":{"timeoutSeconds":5,"intervalSeconds":10}}`, "config.propagationCheck.intervalSeconds: Invalid value: 10: must not exceed timeoutSeconds (5)"},
+		{`{"propagationCheck":{"timeoutSeconds":0,"intervalSeconds":3600}}`, "config.propagationCheck.intervalSeconds: Invalid value: 3600: must not exceed timeoutSeconds (20)"},
+		{`{"verifyChanges":{"timeoutSeconds":-1}}`, "config.verifyChanges.timeoutSeconds: Invalid value: -1: must not be negative"},
+		{`{"verifyChanges":{"timeoutSeconds":900}}`, "config.verifyChanges.timeoutSeconds: Invalid value: 900: must not exceed 30"},
+		{`{"verifyChanges":{"intervalSeconds":-1}}`, "config.verifyChanges.intervalSeconds: Invalid value: -1: must not be negative"},
+		{`{"verifyChanges":{"timeoutSeconds":5,"intervalSeconds":10}}`, "config.verifyChanges.intervalSeconds: Invalid value: 10: must not exceed timeoutSeconds (5)"},
+		{`{"verifyChanges":{"timeoutSeconds":0,"intervalSeconds":3600}}`, "config.verifyChanges.intervalSeconds: Invalid value: 3600: must not exceed timeoutSeconds (30)"},
+	} {
+		_, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: []byte(tc.raw)})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tc.raw, tc.want, err)
+		}
+	}
+}
+
+func TestLoadConfigCredentialSources(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want string
+	}{
+		{`{"credentialsSecretName":"a","vault":{"path":"p"}}`, "config.vault: Forbidden: may not be set together with credentialsSecretName"},
+		{`{"credentials":{"clientId":{"file":"id"},"clientSecret":{"secretKeyRef":{"name":"s"}},"username":{"file":"u","secretKeyRef":{"name":"s","key":"k"}}}}`, "config.credentials.clientSecret.secretKeyRef.key: Required value"},
+		{`{"credentials":{"clientId":{"file":"id"}}}`, "config.credentials.password: Required value"},
+		{`{"credentialsSecretName":"a","credentialsSecretName":"b"}`, "config.credentialsSecretName: Duplicate value"},
+	} {
+		_, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: []byte(tc.raw)})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tc.raw, tc.want, err)
+		}
+	}
+}
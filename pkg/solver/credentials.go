@@ -0,0 +1,320 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"cert-manager-webhook-contabo/pkg/tracing"
+)
+
+const (
+	secretKeyClientID     = "clientId"
+	secretKeyClientSecret = "clientSecret"
+	secretKeyUsername     = "username"
+	secretKeyPassword     = "password"
+)
+
+type credentials struct {
+	clientID     string
+	clientSecret string
+	username     string
+	password     string
+
+	// scopes restrict which zones and names these credentials may write. Every
+	// Secret the credentials were read from contributes its own scope.
+	scopes []scope
+
+	// source says where the credentials were read from, for the audit log.
+	source string
+}
+
+func (c *credentials) authorize(zone, fqdn string) error {
+	for _, sc := range c.scopes {
+		if err := sc.authorize(zone, fqdn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithCredentialsFilesDir allows ClusterIssuers to read credentials from files
+// below dir, typically Secrets synced by a CSI secrets-store driver.
+func WithCredentialsFilesDir(dir string) Option {
+	return func(s *Solver) {
+		s.credentialsFilesDir = dir
+	}
+}
+
+// credentialsSource loads the Contabo credentials for a challenge. Each way of
+// configuring credentials in Config maps to one implementation.
+type credentialsSource interface {
+	load(ctx context.Context, ch *v1alpha1.ChallengeRequest) (*credentials, error)
+}
+
+func (s *Solver) credentialsSource(cfg *Config) credentialsSource {
+	switch {
+	case cfg.Vault != nil:
+		return &vaultSource{solver: s, ref: *cfg.Vault}
+	case cfg.Credentials != nil:
+		return &fieldSources{solver: s, sources: *cfg.Credentials}
+	case cfg.CredentialsSecretRef != nil:
+		return &secretSource{solver: s, ref: *cfg.CredentialsSecretRef}
+	case cfg.CredentialsSecretName != "":
+		return &secretSource{solver: s, ref: SecretRef{Name: cfg.CredentialsSecretName, Namespace: cfg.CredentialsSecretNamespace}}
+	default:
+		return &ambientSource{solver: s}
+	}
+}
+
+func (s *Solver) loadCredentials(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *Config) (creds *credentials, err error) {
+	source := s.credentialsSource(cfg)
+	ctx, span := tracing.Tracer(ctx).Start(ctx, "LoadCredentials",
+		trace.WithAttributes(attrCredentialsSource.String(credentialsSourceName(source))))
+	defer func() { endSpan(span, err) }()
+	return source.load(ctx, ch)
+}
+
+// credentialsSourceName names source for spans.
+func credentialsSourceName(source credentialsSource) string {
+	switch source.(type) {
+	case *secretSource:
+		return "secret"
+	case *fieldSources:
+		return "fields"
+	case *vaultSource:
+		return "vault"
+	default:
+		return "ambient"
+	}
+}
+
+func (s *Solver) getSecret(ctx context.Context, ch *v1alpha1.ChallengeRequest, namespace, name string) (secret *corev1.Secret, err error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	if namespace == "" {
+		namespace = ch.ResourceNamespace
+	}
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace of credentials secret %q is required when challenge resource namespace is empty", name)
+	}
+	if err := s.checkSecretNamespace(ch, namespace, name); err != nil {
+		return nil, &Error{Class: ErrorClassPermission, Err: err}
+	}
+
+	ctx, span := tracing.Tracer(ctx).Start(ctx, "GetSecret", trace.WithAttributes(
+		attrSecretNamespace.String(namespace),
+		attrSecretName.String(name),
+	))
+	defer func() { endSpan(span, err) }()
+
+	secret, err = s.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, &Error{Class: secretErrorClass(err), Err: fmt.Errorf("failed to get credentials secret %s/%s: %w", namespace, name, err)}
+	}
+	return secret, nil
+}
+
+// secretSource reads all credentials from a single Secret.
+type secretSource struct {
+	solver *Solver
+	ref    SecretRef
+}
+
+func (src *secretSource) load(ctx context.Context, ch *v1alpha1.ChallengeRequest) (*credentials, error) {
+	secret, err := src.solver.getSecret(ctx, ch, src.ref.Namespace, src.ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	return credentialsFromSecretKeys(secret, src.ref.Keys)
+}
+
+func credentialsFromSecret(secret *corev1.Secret) (*credentials, error) {
+	return credentialsFromSecretKeys(secret, SecretKeys{})
+}
+
+func credentialsFromSecretKeys(secret *corev1.Secret, keys SecretKeys) (*credentials, error) {
+	keys = keys.withDefaults()
+
+	clientID := strings.TrimSpace(string(secret.Data[keys.ClientID]))
+	clientSecret := strings.TrimSpace(string(secret.Data[keys.ClientSecret]))
+	username := strings.TrimSpace(string(secret.Data[keys.Username]))
+	password := strings.TrimSpace(string(secret.Data[keys.Password]))
+
+	if clientID == "" || clientSecret == "" || username == "" || password == "" {
+		return nil, fmt.Errorf(
+			"secret %s/%s must contain non-empty %q, %q, %q, and %q keys",
+			secret.GetNamespace(),
+			secret.GetName(),
+			keys.ClientID,
+			keys.ClientSecret,
+			keys.Username,
+			keys.Password,
+		)
+	}
+
+	sc, err := scopeFromAnnotations(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &credentials{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		username:     username,
+		password:     password,
+		scopes:       []scope{sc},
+		source:       fmt.Sprintf("secret %s/%s", secret.GetNamespace(), secret.GetName()),
+	}, nil
+}
+
+func (k SecretKeys) withDefaults() SecretKeys {
+	if k.ClientID == "" {
+		k.ClientID = secretKeyClientID
+	}
+	if k.ClientSecret == "" {
+		k.ClientSecret = secretKeyClientSecret
+	}
+	if k.Username == "" {
+		k.Username = secretKeyUsername
+	}
+	if k.Password == "" {
+		k.Password = secretKeyPassword
+	}
+	return k
+}
+
+// fieldSources reads every credential field from its own ValueSource.
+type fieldSources struct {
+	solver  *Solver
+	sources CredentialSources
+}
+
+func (src *fieldSources) load(ctx context.Context, ch *v1alpha1.ChallengeRequest) (*credentials, error) {
+	r := &sourceReader{solver: src.solver, ch: ch, secrets: map[string]*corev1.Secret{}}
+	creds := &credentials{}
+	sources := src.sources
+
+	fields := []struct {
+		name   string
+		source ValueSource
+		value  *string
+	}{
+		{secretKeyClientID, sources.ClientID, &creds.clientID},
+		{secretKeyClientSecret, sources.ClientSecret, &creds.clientSecret},
+		{secretKeyUsername, sources.Username, &creds.username},
+		{secretKeyPassword, sources.Password, &creds.password},
+	}
+	for _, field := range fields {
+		value, err := r.read(ctx, field.name, field.source)
+		if err != nil {
+			return nil, err
+		}
+		*field.value = value
+	}
+
+	creds.scopes = r.scopes
+	creds.source = strings.Join(r.origins, ", ")
+	return creds, nil
+}
+
+// sourceReader resolves ValueSources for a single challenge, fetching each
+// referenced Secret once.
+type sourceReader struct {
+	solver  *Solver
+	ch      *v1alpha1.ChallengeRequest
+	secrets map[string]*corev1.Secret
+	scopes  []scope
+	// origins lists the Secrets and files read, in order.
+	origins []string
+}
+
+func (r *sourceReader) read(ctx context.Context, field string, source ValueSource) (string, error) {
+	var value string
+	switch {
+	case source.SecretKeyRef != nil && source.File != "":
+		return "", fmt.Errorf("credentials.%s: only one of secretKeyRef and file may be set", field)
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		if ref.Name == "" || ref.Key == "" {
+			return "", fmt.Errorf("credentials.%s.secretKeyRef: name and key are required", field)
+		}
+		secret, err := r.secret(ctx, ref.Namespace, ref.Name)
+		if err != nil {
+			return "", err
+		}
+		value = strings.TrimSpace(string(secret.Data[ref.Key]))
+		if value == "" {
+			return "", fmt.Errorf("credentials.%s: secret %s/%s must contain non-empty %q key", field, secret.GetNamespace(), secret.GetName(), ref.Key)
+		}
+	case source.File != "":
+		b, err := r.solver.readCredentialsFile(r.ch, source.File)
+		if err != nil {
+			return "", fmt.Errorf("credentials.%s: %w", field, err)
+		}
+		value = strings.TrimSpace(string(b))
+		if value == "" {
+			return "", fmt.Errorf("credentials.%s: file %q is empty", field, source.File)
+		}
+		if origin := "file " + source.File; !slices.Contains(r.origins, origin) {
+			r.origins = append(r.origins, origin)
+		}
+	default:
+		return "", fmt.Errorf("credentials.%s: one of secretKeyRef or file is required", field)
+	}
+	return value, nil
+}
+
+func (r *sourceReader) secret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	if namespace == "" {
+		namespace = r.ch.ResourceNamespace
+	}
+	key := namespace + "/" + name
+	if secret, ok := r.secrets[key]; ok {
+		return secret, nil
+	}
+
+	secret, err := r.solver.getSecret(ctx, r.ch, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := scopeFromAnnotations(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	r.secrets[key] = secret
+	r.scopes = append(r.scopes, sc)
+	r.origins = append(r.origins, "secret "+key)
+	return secret, nil
+}
+
+// readCredentialsFile reads a file below the credentials files directory.
+// Files are shared by the whole webhook, so only ClusterIssuers may use them.
+func (s *Solver) readCredentialsFile(ch *v1alpha1.ChallengeRequest, name string) ([]byte, error) {
+	if s.credentialsFilesDir == "" {
+		return nil, fmt.Errorf("file credential sources are disabled: the webhook was started without --credentials-files-dir")
+	}
+	if !s.isClusterIssuer(ch) {
+		return nil, fmt.Errorf("file credential sources may only be used by ClusterIssuers")
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("file %q must be a relative path inside the credentials files directory", name)
+	}
+
+	b, err := os.ReadFile(filepath.Join(s.credentialsFilesDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	return b, nil
+}
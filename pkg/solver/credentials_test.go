@@ -0,0 +1,133 @@
+package solver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCredentialsSecretRefKeyOverrides(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "synced", Namespace: "tenant-ns"},
+		Data: map[string][]byte{
+			"CONTABO_CLIENT_ID":     []byte("id"),
+			"CONTABO_CLIENT_SECRET": []byte("secret"),
+			secretKeyUsername:       []byte("user"),
+			"api-password":          []byte("pass"),
+		},
+	}
+
+	s := NewSolver()
+	s.client = kubefake.NewSimpleClientset(secret)
+
+	cfg := &Config{CredentialsSecretRef: &SecretRef{
+		Name: "synced",
+		Keys: SecretKeys{ClientID: "CONTABO_CLIENT_ID", ClientSecret: "CONTABO_CLIENT_SECRET", Password: "api-password"},
+	}}
+	creds, err := s.loadCredentials(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "tenant-ns"}, cfg)
+	if err != nil {
+		t.Fatalf("load credentials: %v", err)
+	}
+	if creds.clientID != "id" || creds.clientSecret != "secret" || creds.username != "user" || creds.password != "pass" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+}
+
+func TestCredentialsFromMultipleSecrets(t *testing.T) {
+	client := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "oauth-client",
+			Namespace:   "tenant-ns",
+			Annotations: map[string]string{AnnotationAllowedZones: "example.com"},
+		},
+		Data: map[string][]byte{"id": []byte("id"), "secret": []byte("secret")},
+	}
+	user := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-user", Namespace: "tenant-ns"},
+		Data:       map[string][]byte{"username": []byte("user"), "password": []byte("pass")},
+	}
+
+	s := NewSolver()
+	s.client = kubefake.NewSimpleClientset(client, user)
+
+	cfg := &Config{Credentials: &CredentialSources{
+		ClientID:     ValueSource{SecretKeyRef: &SecretKeySelector{Name: "oauth-client", Key: "id"}},
+		ClientSecret: ValueSource{SecretKeyRef: &SecretKeySelector{Name: "oauth-client", Key: "secret"}},
+		Username:     ValueSource{SecretKeyRef: &SecretKeySelector{Name: "api-user", Key: "username"}},
+		Password:     ValueSource{SecretKeyRef: &SecretKeySelector{Name: "api-user", Key: "password"}},
+	}}
+	creds, err := s.loadCredentials(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "tenant-ns"}, cfg)
+	if err != nil {
+		t.Fatalf("load credentials: %v", err)
+	}
+	if creds.clientID != "id" || creds.clientSecret != "secret" || creds.username != "user" || creds.password != "pass" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+	if len(creds.scopes) != 2 {
+		t.Fatalf("expected one scope per secret, got %d", len(creds.scopes))
+	}
+	if err := creds.authorize("example.org", "_acme-challenge.example.org"); err == nil {
+		t.Fatalf("expected annotation of oauth-client secret to restrict zones")
+	}
+}
+
+func TestCredentialsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "contabo"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for name, value := range map[string]string{"client-id": "id", "client-secret": "secret", "username": "user", "password": "pass\n"} {
+		if err := os.WriteFile(filepath.Join(dir, "contabo", name), []byte(value), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	cfg := &Config{Credentials: &CredentialSources{
+		ClientID:     ValueSource{File: "contabo/client-id"},
+		ClientSecret: ValueSource{File: "contabo/client-secret"},
+		Username:     ValueSource{File: "contabo/username"},
+		Password:     ValueSource{File: "contabo/password"},
+	}}
+	clusterIssuer := &v1alpha1.ChallengeRequest{ResourceNamespace: DefaultClusterResourceNamespace}
+
+	if _, err := NewSolver().loadCredentials(context.Background(), clusterIssuer, cfg); err == nil {
+		t.Fatalf("expected error when file sources are disabled")
+	}
+
+	s := NewSolver(WithCredentialsFilesDir(dir))
+	creds, err := s.loadCredentials(context.Background(), clusterIssuer, cfg)
+	if err != nil {
+		t.Fatalf("load credentials: %v", err)
+	}
+	if creds.clientID != "id" || creds.password != "pass" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+
+	if _, err := s.loadCredentials(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "tenant-ns"}, cfg); err == nil {
+		t.Fatalf("expected error for namespaced issuer")
+	}
+
+	cfg.Credentials.Password = ValueSource{File: "../etc/passwd"}
+	if _, err := s.loadCredentials(context.Background(), clusterIssuer, cfg); err == nil {
+		t.Fatalf("expected error for path outside credentials dir")
+	}
+}
+
+func TestLoadConfigCredentialSourcesExclusive(t *testing.T) {
+	raw := []byte(`{"credentialsSecretName":"a","credentialsSecretRef":{"name":"b"}}`)
+	if _, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: raw}); err == nil {
+		t.Fatalf("expected error for multiple credential sources")
+	}
+
+	raw = []byte(`{"credentialsSecretRef":{"keys":{"clientId":"id"}}}`)
+	if _, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: raw}); err == nil {
+		t.Fatalf("expected error for credentialsSecretRef without name")
+	}
+}
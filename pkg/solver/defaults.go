@@ -0,0 +1,220 @@
+package solver
+
+import (
+	"bytes"
+	encodingjson "encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/json"
+	"sigs.k8s.io/yaml"
+
+	"cert-manager-webhook-contabo/pkg/metrics"
+)
+
+// EnvDefaultsFile names the defaults file when --defaults-file is not given.
+const EnvDefaultsFile = "CONTABO_WEBHOOK_DEFAULTS_FILE"
+
+// defaultsReloadDelay batches the burst of events a single update of the
+// file causes, such as the symlink swap of a ConfigMap volume.
+const defaultsReloadDelay = 500 * time.Millisecond
+
+// DefaultsFile is the webhook-wide defaults file, in YAML or JSON.
+type DefaultsFile struct {
+	// APIVersion is the version of the file and of the configs in it.
+	// Defaults to v1.
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Defaults are merged under every Issuer's config: fields the Issuer
+	// sets win.
+	Defaults encodingjson.RawMessage `json:"defaults,omitempty"`
+	// Overrides are merged over every Issuer's config, enforcing policy
+	// such as staleRecords or dryRun for the whole cluster.
+	Overrides encodingjson.RawMessage `json:"overrides,omitempty"`
+}
+
+// Defaults are the decoded layers of a DefaultsFile, ready to be merged
+// with Issuer configs.
+type Defaults struct {
+	defaults  map[string]any
+	overrides map[string]any
+	raw       []byte
+}
+
+// WithDefaults merges defaults into the config of every Issuer using the
+// default profile. When path is set, the file is watched after Initialize and
+// reloaded when it changes. A reload that fails validation keeps the previous
+// defaults.
+func WithDefaults(path string, defaults *Defaults) Option {
+	return func(s *Solver) {
+		p := s.defaultProfile
+		p.defaultsPath = path
+		p.loadDefaults = func() (*Defaults, error) { return LoadDefaultsFile(path) }
+		p.defaults.Store(defaults)
+	}
+}
+
+// LoadDefaultsFile reads and validates the defaults file at path.
+func LoadDefaultsFile(path string) (*Defaults, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read defaults file: %w", err)
+	}
+	defaults, err := parseDefaults(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid defaults file %s: %w", path, err)
+	}
+	return defaults, nil
+}
+
+func parseDefaults(b []byte) (*Defaults, error) {
+	raw, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var file DefaultsFile
+	strictErrs, err := json.UnmarshalStrict(raw, &file)
+	if err != nil {
+		return nil, err
+	}
+	var errs field.ErrorList
+	for _, strictErr := range strictErrs {
+		errs = append(errs, strictError(nil, strictErr))
+	}
+	if file.APIVersion != "" && file.APIVersion != ConfigVersionV1 {
+		errs = append(errs, field.NotSupported(field.NewPath("apiVersion"), file.APIVersion, []string{ConfigVersionV1}))
+	}
+
+	defaults := &Defaults{raw: raw}
+	defaults.defaults, errs = parseDefaultsLayer(field.NewPath("defaults"), file.Defaults, errs)
+	defaults.overrides, errs = parseDefaultsLayer(field.NewPath("overrides"), file.Overrides, errs)
+	if len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return defaults, nil
+}
+
+// parseDefaultsLayer checks a layer of the defaults file as a config of its
+// own and returns it as a map for merging.
+func parseDefaultsLayer(fldPath *field.Path, raw encodingjson.RawMessage, errs field.ErrorList) (map[string]any, field.ErrorList) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, errs
+	}
+
+	var cfg Config
+	strictErrs, err := json.UnmarshalStrict(raw, &cfg)
+	if err != nil {
+		return nil, append(errs, field.Invalid(fldPath, string(raw), err.Error()))
+	}
+	for _, strictErr := range strictErrs {
+		errs = append(errs, strictError(fldPath, strictErr))
+	}
+	// Credentials belong to each Issuer. Webhook-wide credentials are
+	// ambient credentials, which only ClusterIssuers may use.
+	for name, set := range map[string]bool{
+		"credentialsSecretName":      cfg.CredentialsSecretName != "",
+		"credentialsSecretNamespace": cfg.CredentialsSecretNamespace != "",
+		"credentialsSecretRef":       cfg.CredentialsSecretRef != nil,
+		"credentials":                cfg.Credentials != nil,
+		"vault":                      cfg.Vault != nil,
+	} {
+		if set {
+			errs = append(errs, field.Forbidden(fldPath.Child(name), "credentials can only be set by Issuers"))
+		}
+	}
+	if cfg.APIVersion != "" {
+		errs = append(errs, field.Forbidden(fldPath.Child("apiVersion"), "set the apiVersion of the file instead"))
+	}
+	cfg.setDefaults()
+	errs = append(errs, cfg.validate(fldPath)...)
+
+	var layer map[string]any
+	if err := encodingjson.Unmarshal(raw, &layer); err != nil {
+		return nil, append(errs, field.Invalid(fldPath, string(raw), "must be an object"))
+	}
+	return layer, errs
+}
+
+// apply merges d with the raw config of an Issuer.
+func (d *Defaults) apply(raw []byte) ([]byte, error) {
+	if d == nil || (d.defaults == nil && d.overrides == nil) {
+		return raw, nil
+	}
+	var cfg map[string]any
+	if err := encodingjson.Unmarshal(raw, &cfg); err != nil {
+		return nil, err
+	}
+	return encodingjson.Marshal(mergeJSON(mergeJSON(d.defaults, cfg), d.overrides))
+}
+
+// mergeJSON returns base with overlay merged into it. Objects are merged
+// field by field, any other value of overlay replaces that of base.
+func mergeJSON(base, overlay map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(overlay))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		baseObject, baseIsObject := merged[key].(map[string]any)
+		overlayObject, overlayIsObject := value.(map[string]any)
+		if baseIsObject && overlayIsObject {
+			merged[key] = mergeJSON(baseObject, overlayObject)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// watchDefaults reloads the defaults of p whenever the directory of its file
+// changes, so that updates of a mounted ConfigMap are seen too.
+func (p *profile) watchDefaults(stopCh <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		klog.Errorf("failed to watch defaults of solver %s, changes need a restart: %v", p.name, err)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(p.defaultsPath)); err != nil {
+		klog.Errorf("failed to watch defaults of solver %s, changes need a restart: %v", p.name, err)
+		return
+	}
+	klog.Infof("watching defaults of solver %s in %s", p.name, p.defaultsPath)
+
+	reload := time.NewTimer(defaultsReloadDelay)
+	reload.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-watcher.Events:
+			reload.Reset(defaultsReloadDelay)
+		case err := <-watcher.Errors:
+			klog.Errorf("error watching defaults file: %v", err)
+		case <-reload.C:
+			p.reloadDefaults()
+		}
+	}
+}
+
+// reloadDefaults replaces the defaults of p with the current contents of its
+// file, unless they are invalid.
+func (p *profile) reloadDefaults() {
+	defaults, err := p.loadDefaults()
+	if err != nil {
+		metrics.DefaultsReloads.WithLabelValues(p.name, metrics.ResultError).Inc()
+		klog.Errorf("rejected defaults of solver %s, keeping the previous ones: %v", p.name, err)
+		return
+	}
+	if current := p.defaults.Load(); current != nil && bytes.Equal(current.raw, defaults.raw) {
+		return
+	}
+	p.defaults.Store(defaults)
+	metrics.DefaultsReloads.WithLabelValues(p.name, metrics.ResultSuccess).Inc()
+	klog.Infof("reloaded defaults of solver %s from %s", p.name, p.defaultsPath)
+}
@@ -0,0 +1,120 @@
+package solver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+const testDefaults = `
+apiVersion: v1
+defaults:
+  baseUrl: https://sandbox.example.com
+  ttl: 300
+  propagationCheck:
+    timeoutSeconds: 25
+overrides:
+  staleRecords:
+    action: Fail
+`
+
+func writeDefaults(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write defaults: %v", err)
+	}
+}
+
+func TestDefaultsMergedWithIssuerConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "defaults.yaml")
+	writeDefaults(t, path, testDefaults)
+	defaults, err := LoadDefaultsFile(path)
+	if err != nil {
+		t.Fatalf("load defaults: %v", err)
+	}
+	s := NewSolver(WithDefaults("", defaults))
+
+	raw := `{"credentialsSecretName":"creds","ttl":600,"propagationCheck":{"intervalSeconds":5},"staleRecords":{"action":"Delete"}}`
+	cfg, err := s.loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: []byte(raw)})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.BaseURL != "https://sandbox.example.com" || cfg.TTL != 600 || cfg.CredentialsSecretName != "creds" {
+		t.Fatalf("expected the issuer's fields over the defaults, got %+v", cfg)
+	}
+	if cfg.PropagationCheck.TimeoutSecs != 25 || cfg.PropagationCheck.IntervalSecs != 5 {
+		t.Fatalf("expected propagationCheck to be merged, got %+v", cfg.PropagationCheck)
+	}
+	if cfg.StaleRecords.Action != StaleRecordsFail {
+		t.Fatalf("expected the override to win, got %+v", cfg.StaleRecords)
+	}
+
+	// Unknown fields of the issuer are still reported with its own paths.
+	if _, err := s.loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: []byte(`{"ttlSeconds":60}`)}); err == nil || !strings.Contains(err.Error(), "config.ttlSeconds") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestInvalidDefaultsRejected(t *testing.T) {
+	for _, tc := range []struct {
+		content string
+		want    string
+	}{
+		{"defaults:\n  ttlSeconds: 60\n", "defaults.ttlSeconds: Forbidden: unknown field"},
+		{"defaults:\n  credentialsSecretName: shared\n", "defaults.credentialsSecretName: Forbidden"},
+		{"overrides:\n  ttl: 5\n", "overrides.ttl: Invalid value: 5"},
+		{"apiVersion: v2\n", `apiVersion: Unsupported value: "v2"`},
+		{"default:\n  ttl: 60\n", "default: Forbidden: unknown field"},
+	} {
+		if _, err := parseDefaults([]byte(tc.content)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected error containing %q, got %v", tc.content, tc.want, err)
+		}
+	}
+}
+
+func TestDefaultsReloadedOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "defaults.yaml")
+	writeDefaults(t, path, testDefaults)
+	defaults, err := LoadDefaultsFile(path)
+	if err != nil {
+		t.Fatalf("load defaults: %v", err)
+	}
+	s := NewSolver(WithDefaults(path, defaults))
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	go s.defaultProfile.watchDefaults(stopCh)
+
+	ttl := func() int {
+		cfg, err := s.loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: []byte(`{}`)})
+		if err != nil {
+			t.Fatalf("load config: %v", err)
+		}
+		return cfg.TTL
+	}
+	waitForTTL := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for ttl() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected ttl %d, got %d", want, ttl())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	// Give the watcher time to start before changing the file.
+	time.Sleep(100 * time.Millisecond)
+	writeDefaults(t, path, "defaults:\n  ttl: 900\n")
+	waitForTTL(900)
+
+	// An invalid file keeps the previous defaults.
+	writeDefaults(t, path, "defaults:\n  ttl: 5\n")
+	time.Sleep(2 * defaultsReloadDelay)
+	if got := ttl(); got != 900 {
+		t.Fatalf("expected the invalid reload to be rejected, got ttl %d", got)
+	}
+}
@@ -0,0 +1,253 @@
+package solver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"golang.org/x/net/dns/dnsmessage"
+	"k8s.io/klog/v2"
+
+	"cert-manager-webhook-contabo/pkg/audit"
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+const (
+	delegationLabelPrefix = "_acme-challenge-"
+	dnsQueryTimeout       = 2 * time.Second
+	notQueried            = "not queried yet"
+)
+
+// delegatedChallenge returns ch with its record moved to the validation zone
+// when cfg delegates, or ch itself otherwise. Challenges whose zone already is
+// the validation zone, because cert-manager followed the CNAME, are returned
+// unchanged.
+func delegatedChallenge(cfg *Config, ch *v1alpha1.ChallengeRequest) *v1alpha1.ChallengeRequest {
+	if cfg.Delegation == nil {
+		return ch
+	}
+	validationZone := normalizeName(cfg.Delegation.ValidationZone)
+	if normalizeName(ch.ResolvedZone) == validationZone {
+		return ch
+	}
+
+	target := *ch
+	target.ResolvedZone = validationZone + "."
+	target.ResolvedFQDN = delegationLabel(ch.ResolvedFQDN) + "." + validationZone + "."
+	return &target
+}
+
+// delegationLabel derives the record name in the validation zone from the
+// challenge FQDN, so every name gets its own stable CNAME target.
+func delegationLabel(fqdn string) string {
+	sum := sha256.Sum256([]byte(normalizeName(fqdn)))
+	return delegationLabelPrefix + hex.EncodeToString(sum[:10])
+}
+
+// ensureDelegation makes sure the challenge's zone delegates ch's name to
+// target's, creating the CNAME if the config allows it, and waits until the
+// zone's nameservers serve it. Each CNAME is checked once per process.
+func (s *Solver) ensureDelegation(ctx context.Context, cfg *Config, ch, target *v1alpha1.ChallengeRequest) error {
+	zone := normalizeZone(ch.ResolvedZone)
+	recordName := relativeRecordName(ch.ResolvedFQDN, ch.ResolvedZone)
+	want := normalizeName(target.ResolvedFQDN)
+
+	// The record in the validation zone answers for ch's name, so the
+	// credentials must be allowed to act for that name too, whether or not
+	// they create the CNAME.
+	creds, err := s.loadCredentials(ctx, ch, cfg)
+	if err != nil {
+		return credentialsFailure(err)
+	}
+	if err := creds.authorize(zone, ch.ResolvedFQDN); err != nil {
+		return &Error{Class: ErrorClassPermission, Err: err}
+	}
+
+	key := zone + "|" + recordName
+	if verified, ok := s.delegations.Load(key); ok && verified == want {
+		return nil
+	}
+
+	if cfg.Delegation.EnsureCNAME {
+		if err := s.ensureCNAME(ctx, cfg, ch, creds, zone, recordName, want); err != nil {
+			return err
+		}
+	}
+	// The CNAME a dry run would have created can't be waited for.
+	if s.isDryRun(cfg) {
+		return nil
+	}
+
+	check := PropagationCheck{Nameservers: cfg.Delegation.Nameservers}
+	if cfg.PropagationCheck != nil {
+		check.TimeoutSecs = cfg.PropagationCheck.TimeoutSecs
+		check.IntervalSecs = cfg.PropagationCheck.IntervalSecs
+	}
+	if err := waitForDelegation(ctx, &check, zone, ch.ResolvedFQDN, want); err != nil {
+		return err
+	}
+	s.delegations.Store(key, want)
+	return nil
+}
+
+// ensureCNAME creates the delegating CNAME unless it exists, holding the
+// record lock and the zone's Lease from the lookup to the create. A CNAME
+// pointing elsewhere or TXT records at the name are reported instead of
+// overwritten.
+func (s *Solver) ensureCNAME(ctx context.Context, cfg *Config, ch *v1alpha1.ChallengeRequest, creds *credentials, zone, recordName, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+
+	client, err := s.newClient(cfg, creds)
+	if err != nil {
+		return &Error{Class: ErrorClassCredentials, Err: err}
+	}
+
+	defer s.locks.lock(zone, recordName)()
+	ctx, unlock, err := s.lockZone(ctx, creds, zone)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records, err := client.ListRecords(ctx, zone, recordName)
+	if err != nil {
+		return zoneError(ctx, client, zone, err)
+	}
+	for _, record := range records {
+		if record.Name != recordName {
+			continue
+		}
+		switch {
+		case strings.EqualFold(record.Type, "CNAME") && normalizeName(record.Data) == target:
+			return nil
+		case strings.EqualFold(record.Type, "CNAME"):
+			return &Error{Class: ErrorClassConfiguration, Err: fmt.Errorf("%s in zone %s is a CNAME to %s, expected %s", recordName, zone, record.Data, target)}
+		case strings.EqualFold(record.Type, "TXT"):
+			return &Error{Class: ErrorClassConfiguration, Err: fmt.Errorf("cannot delegate %s in zone %s: TXT records exist at that name (record %d)", recordName, zone, record.RecordID)}
+		}
+	}
+
+	if s.isDryRun(cfg) {
+		s.skipChange(ctx, ch, "create CNAME record %s to %s in zone %s", recordName, target, zone)
+		return nil
+	}
+	klog.FromContext(ctx).Info("Creating delegating CNAME record", "recordName", recordName, "target", target)
+	err = client.CreateRecord(ctx, zone, contabo.CreateRecordRequest{
+		Name: recordName,
+		Type: "CNAME",
+		TTL:  cfg.ttl(),
+		Data: dnsName(target),
+	})
+	s.recordAudit(ctx, ch, creds, audit.ActionCreate, auditReasonDelegation, zone, recordName, "CNAME", 0, err)
+	return err
+}
+
+// waitForDelegation polls the zone's authoritative nameservers until each of
+// them answers fqdn with a CNAME to target.
+func waitForDelegation(ctx context.Context, check *PropagationCheck, zone, fqdn, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout())
+	defer cancel()
+
+	nameservers, err := authoritativeNameservers(ctx, check, zone)
+	if err != nil {
+		return err
+	}
+
+	fqdn = dnsName(fqdn)
+	lagging := make(map[string]string, len(nameservers))
+	for _, ns := range nameservers {
+		lagging[ns] = notQueried
+	}
+
+	ticker := time.NewTicker(check.interval())
+	defer ticker.Stop()
+
+	for {
+		for ns := range lagging {
+			cname, err := nameserverCNAME(ctx, ns, fqdn)
+			switch {
+			case err != nil:
+				// Keep the last answer of the nameserver, which says more
+				// than a query cut short by the deadline.
+				if lagging[ns] == notQueried {
+					lagging[ns] = err.Error()
+				}
+			case cname == "":
+				lagging[ns] = "no CNAME"
+			case normalizeName(cname) != target:
+				lagging[ns] = "CNAME to " + cname
+			default:
+				delete(lagging, ns)
+			}
+		}
+		if len(lagging) == 0 {
+			klog.FromContext(ctx).Info("Challenge name is delegated", "target", target)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s does not resolve to a CNAME to %s: %s", fqdn, target, describeLagging(lagging))
+		case <-ticker.C:
+		}
+	}
+}
+
+// nameserverCNAME asks ns for the CNAME of fqdn over UDP. It returns "" when
+// there is none.
+func nameserverCNAME(ctx context.Context, ns, fqdn string) (string, error) {
+	name, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return "", err
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32())},
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return "", err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", ns)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(dnsQueryTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if _, err := conn.Write(packed); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 1232)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf[:n]); err != nil {
+		return "", err
+	}
+	if resp.ID != query.ID {
+		return "", fmt.Errorf("mismatched DNS response ID")
+	}
+	for _, answer := range resp.Answers {
+		if cname, ok := answer.Body.(*dnsmessage.CNAMEResource); ok {
+			return cname.CNAME.String(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,128 @@
+package solver
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+const validationZone = "acme.example.net"
+
+func TestDelegationWritesToValidationZone(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	ns := newTestNameserver(t)
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.Delegation = &Delegation{ValidationZone: validationZone + ".", EnsureCNAME: true, Nameservers: []string{ns.addr()}}
+		cfg.PropagationCheck = nil
+	})
+	WithLedger("webhook-ns")(s)
+
+	target := delegationLabel(ch.ResolvedFQDN) + "." + validationZone + "."
+	ns.setCNAME(ch.ResolvedFQDN, target)
+
+	for range 2 {
+		if err := s.Present(ch); err != nil {
+			t.Fatalf("present: %v", err)
+		}
+	}
+
+	source := f.visible()
+	if len(source) != 1 || source[0].Type != "CNAME" || source[0].Data != target {
+		t.Fatalf("expected a single CNAME to %s in the source zone, got %+v", target, source)
+	}
+	validation := f.visibleIn(validationZone)
+	if len(validation) != 1 || validation[0].Type != "TXT" || validation[0].Name != delegationLabel(ch.ResolvedFQDN) || validation[0].Data != "key" {
+		t.Fatalf("expected the TXT record in the validation zone, got %+v", validation)
+	}
+
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if len(f.visibleIn(validationZone)) != 0 {
+		t.Fatalf("expected the TXT record to be deleted")
+	}
+	if len(f.visible()) != 1 {
+		t.Fatalf("expected the CNAME to be kept")
+	}
+}
+
+func TestDelegationFollowedByCertManager(t *testing.T) {
+	f := newFakeContabo(t, validationZone)
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.Delegation = &Delegation{ValidationZone: validationZone}
+	})
+
+	// With cnameStrategy Follow, cert-manager already resolved the CNAME.
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if records := f.visible(); len(records) != 1 || records[0].Name != "_acme-challenge" {
+		t.Fatalf("expected the record to be written as resolved, got %+v", records)
+	}
+}
+
+func TestDelegationRejectsConflictingCNAME(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "CNAME", Data: "elsewhere.example.org."})
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.Delegation = &Delegation{ValidationZone: validationZone, EnsureCNAME: true}
+	})
+
+	err := s.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "elsewhere.example.org") {
+		t.Fatalf("expected conflicting CNAME error, got %v", err)
+	}
+	if f.creates != 0 {
+		t.Fatalf("expected no records to be created, got %d", f.creates)
+	}
+}
+
+func TestDelegationChecksResolution(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	ns := newTestNameserver(t)
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.Delegation = &Delegation{ValidationZone: validationZone, Nameservers: []string{ns.addr()}}
+		cfg.PropagationCheck = &PropagationCheck{TimeoutSecs: 1, IntervalSecs: 1, Nameservers: []string{ns.addr()}}
+	})
+	ns.setCNAME(ch.ResolvedFQDN, "stale.example.org.")
+
+	err := s.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "CNAME to stale.example.org") {
+		t.Fatalf("expected delegation check error, got %v", err)
+	}
+	if len(f.visibleIn(validationZone)) != 0 {
+		t.Fatalf("expected no TXT record before the delegation resolves")
+	}
+}
+
+func TestDelegationChecksScopeOfChallengeName(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	ns := newTestNameserver(t)
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.Delegation = &Delegation{ValidationZone: validationZone, Nameservers: []string{ns.addr()}}
+		cfg.PropagationCheck = nil
+	})
+	ns.setCNAME(ch.ResolvedFQDN, delegationLabel(ch.ResolvedFQDN)+"."+validationZone+".")
+	// The Secret may write to the validation zone, but not act for the
+	// challenge's own domain.
+	secrets := s.client.CoreV1().Secrets("tenant-ns")
+	secret, err := secrets.Get(t.Context(), "contabo-credentials", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	secret.Annotations = map[string]string{AnnotationAllowedZones: validationZone}
+	if _, err := secrets.Update(t.Context(), secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update secret: %v", err)
+	}
+
+	err = s.Present(ch)
+	if err == nil || ClassOf(err) != ErrorClassPermission || !strings.Contains(err.Error(), "example.com") {
+		t.Fatalf("expected the challenge name to be checked against the Secret's scope, got %v", err)
+	}
+	if len(f.visibleIn(validationZone)) != 0 {
+		t.Fatalf("expected no TXT record in the validation zone")
+	}
+}
@@ -0,0 +1,36 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// EventReasonDryRun is recorded for every record change a dry run skips.
+const EventReasonDryRun = "DryRun"
+
+// WithDryRun puts every challenge in dry-run mode, as if its config set
+// dryRun.
+func WithDryRun() Option {
+	return func(s *Solver) {
+		s.dryRun = true
+	}
+}
+
+// isDryRun reports whether record changes for cfg are only described. A dry
+// run reads credentials, fetches a token and lists records like any other
+// run, but never creates or deletes records nor writes them to the ledger.
+func (s *Solver) isDryRun(cfg *Config) bool {
+	return s.dryRun || cfg.DryRun
+}
+
+// skipChange logs and records an event describing a record change a dry run
+// skips.
+func (s *Solver) skipChange(ctx context.Context, ch *v1alpha1.ChallengeRequest, messageFmt string, args ...any) {
+	message := fmt.Sprintf(messageFmt, args...)
+	klog.FromContext(ctx).Info("Dry run, skipping record change", "change", message)
+	s.event(ch, corev1.EventTypeNormal, EventReasonDryRun, "Dry run: would %s", message)
+}
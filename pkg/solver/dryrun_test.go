@@ -0,0 +1,105 @@
+package solver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+func TestDryRunSkipsChanges(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(*Config)
+		opts      []Option
+	}{
+		{"config", func(cfg *Config) { cfg.DryRun = true }, nil},
+		{"global", nil, []Option{WithDryRun()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeContabo(t, "example.com")
+			s, ch := newTestSolver(t, f, tc.configure)
+			for _, opt := range tc.opts {
+				opt(s)
+			}
+			recorder := record.NewFakeRecorder(10)
+			s.recorder = recorder
+			s.dynamic = newFakeDynamic(newChallengeObject("tenant-ns", "challenge", "challenge-uid"))
+			sink := &memorySink{}
+			WithAuditSink(sink)(s)
+
+			if err := s.Present(ch); err != nil {
+				t.Fatalf("present: %v", err)
+			}
+			// A record left by an earlier run is what CleanUp would delete.
+			f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "key"})
+			if err := s.CleanUp(ch); err != nil {
+				t.Fatalf("cleanup: %v", err)
+			}
+
+			if f.creates != 0 || f.deletes != 0 || len(f.visible()) != 1 {
+				t.Fatalf("expected only the seeded record, got %d creates, %d deletes and records %v", f.creates, f.deletes, f.visible())
+			}
+			if f.lists == 0 {
+				t.Fatalf("expected the dry run to list records")
+			}
+			if len(sink.events) != 0 {
+				t.Fatalf("expected no audit events, got %+v", sink.events)
+			}
+			events := drainEvents(recorder)
+			want := []string{"would create TXT record _acme-challenge", "would delete TXT record _acme-challenge (1)"}
+			if len(events) != len(want) {
+				t.Fatalf("expected %d events, got %v", len(want), events)
+			}
+			for i := range want {
+				if !strings.HasPrefix(events[i], "Normal "+EventReasonDryRun) || !strings.Contains(events[i], want[i]) {
+					t.Fatalf("expected event %d to describe %q, got %q", i, want[i], events[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDryRunKeepsDeferredDeletions(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.CleanupDelay = &metav1.Duration{Duration: time.Hour}
+	})
+	WithLedger("webhook-ns")(s)
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	WithDryRun()(s)
+	retry := *ch
+	retry.UID = "retry-uid"
+	if err := s.Present(&retry); err != nil {
+		t.Fatalf("dry run present: %v", err)
+	}
+	if len(s.cleanups.pending) != 1 {
+		t.Fatalf("expected the deferred deletion to stay scheduled")
+	}
+	entry, err := s.ledger.get(context.Background(), s.client, "challenge-uid")
+	if err != nil || entry == nil || entry.State != ledgerStateCleanupScheduled {
+		t.Fatalf("expected the scheduled deletion to stay in the ledger, got %+v, %v", entry, err)
+	}
+}
+
+func TestDryRunStillFailsOnBadCredentials(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.DryRun = true
+		cfg.CredentialsSecretName = "missing"
+	})
+	if err := s.Present(ch); err == nil {
+		t.Fatalf("expected present to fail")
+	}
+}
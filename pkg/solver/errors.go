@@ -0,0 +1,252 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+	"cert-manager-webhook-contabo/pkg/metrics"
+	"cert-manager-webhook-contabo/pkg/vault"
+)
+
+// ErrorClass says why a challenge failed, and so what fixes it.
+type ErrorClass string
+
+const (
+	// ErrorClassConfiguration is an invalid Issuer config, or a request the
+	// Contabo API rejected as invalid.
+	ErrorClassConfiguration ErrorClass = "configuration"
+	// ErrorClassCredentials is credentials that are missing, incomplete or
+	// rejected by Contabo.
+	ErrorClassCredentials ErrorClass = "credentials"
+	// ErrorClassZoneNotFound is a zone that is not in the Contabo account.
+	ErrorClassZoneNotFound ErrorClass = "zone-not-found"
+	// ErrorClassPermission is a change the credentials may not make, by the
+	// scope of their Secret or the roles of the Contabo user.
+	ErrorClassPermission ErrorClass = "permission"
+	// ErrorClassRateLimited is a request the Contabo API rejected with 429
+	// Too Many Requests.
+	ErrorClassRateLimited ErrorClass = "rate-limited"
+	// ErrorClassTransient is any other failure, such as a timeout or an
+	// outage of the Contabo API.
+	ErrorClassTransient ErrorClass = "transient"
+)
+
+// maxListedZones caps the zones of the account listed in zone-not-found
+// errors.
+const maxListedZones = 10
+
+// Error is a failure of Present or CleanUp with its class. cert-manager
+// retries every failed challenge with a backoff, but only transient errors
+// can succeed without a change to the Issuer, its credentials or the
+// account.
+type Error struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *Error) Error() string {
+	switch e.Class {
+	case ErrorClassZoneNotFound:
+		return fmt.Sprintf("zone not found: %v", e.Err)
+	case ErrorClassPermission:
+		return fmt.Sprintf("permission denied: %v", e.Err)
+	case ErrorClassRateLimited:
+		return fmt.Sprintf("rate limited by the Contabo API, will be retried: %v", e.Err)
+	case ErrorClassTransient:
+		return fmt.Sprintf("transient error, will be retried: %v", e.Err)
+	default:
+		return fmt.Sprintf("%s error: %v", e.Class, e.Err)
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether retrying without any change may succeed.
+func (e *Error) Transient() bool {
+	return e.Class == ErrorClassRateLimited || e.Class == ErrorClassTransient
+}
+
+// ClassOf returns the class of err.
+func ClassOf(err error) ErrorClass {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+	var apiErr *contabo.APIError
+	switch {
+	case errors.Is(err, contabo.ErrAuthentication):
+		return ErrorClassCredentials
+	case errors.As(err, &apiErr):
+		return apiErrorClass(apiErr)
+	default:
+		return ErrorClassTransient
+	}
+}
+
+// IsTransient reports whether err may go away on its own.
+func IsTransient(err error) bool {
+	class := ClassOf(err)
+	return class == ErrorClassRateLimited || class == ErrorClassTransient
+}
+
+func apiErrorClass(err *contabo.APIError) ErrorClass {
+	switch {
+	case err.StatusCode == http.StatusUnauthorized:
+		return ErrorClassCredentials
+	case err.StatusCode == http.StatusForbidden:
+		return ErrorClassPermission
+	case err.StatusCode == http.StatusNotFound:
+		return ErrorClassZoneNotFound
+	case err.StatusCode == http.StatusTooManyRequests:
+		return ErrorClassRateLimited
+	case err.StatusCode == http.StatusRequestTimeout || err.StatusCode >= 500:
+		return ErrorClassTransient
+	default:
+		return ErrorClassConfiguration
+	}
+}
+
+// classify returns err, which must not be nil, as an *Error, keeping the
+// class it already has.
+func classify(err error) *Error {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified
+	}
+	return &Error{Class: ClassOf(err), Err: err}
+}
+
+// credentialsFailure classifies a failure to load credentials. The sources
+// classify what isn't about the credentials themselves, such as a denied
+// Secret reference or an outage of the API server or Vault; anything else
+// means the credentials are missing or incomplete.
+func credentialsFailure(err error) *Error {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified
+	}
+	return &Error{Class: ErrorClassCredentials, Err: err}
+}
+
+// secretErrorClass classifies a failed read of a credentials Secret.
+func secretErrorClass(err error) ErrorClass {
+	switch {
+	case apierrors.IsNotFound(err):
+		return ErrorClassCredentials
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		return ErrorClassPermission
+	default:
+		return ErrorClassTransient
+	}
+}
+
+// vaultErrorClass classifies a failed read of credentials from Vault.
+func vaultErrorClass(err error) ErrorClass {
+	var vaultErr *vault.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &vaultErr):
+		switch {
+		case vaultErr.StatusCode == http.StatusNotFound:
+			return ErrorClassCredentials
+		case vaultErr.StatusCode == http.StatusUnauthorized || vaultErr.StatusCode == http.StatusForbidden:
+			return ErrorClassPermission
+		case vaultErr.StatusCode == http.StatusTooManyRequests || vaultErr.StatusCode == http.StatusRequestTimeout || vaultErr.StatusCode >= 500:
+			return ErrorClassTransient
+		default:
+			return ErrorClassConfiguration
+		}
+	case errors.As(err, &netErr), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTransient
+	default:
+		return ErrorClassCredentials
+	}
+}
+
+// observeError classifies an error of operation for its caller and counts it
+// by class.
+func observeError(ctx context.Context, operation v1alpha1.ChallengeAction, err error) error {
+	if err == nil {
+		return nil
+	}
+	classified := classify(err)
+	metrics.OperationErrors.WithLabelValues(string(operation), string(classified.Class)).Inc()
+	klog.FromContext(ctx).V(2).Info("Challenge failed", "operation", operation, "class", classified.Class, "transient", classified.Transient())
+	return classified
+}
+
+// zoneError explains an API error about zone. When the account doesn't have
+// the zone, it lists the zones it does have and names the closest match. When
+// the zones can't be listed either, baseUrl is most likely wrong.
+func zoneError(ctx context.Context, client *contabo.Client, zone string, err error) error {
+	var apiErr *contabo.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	zones, listErr := client.ListZones(ctx)
+	var listAPIErr *contabo.APIError
+	switch {
+	case errors.As(listErr, &listAPIErr) && listAPIErr.StatusCode == http.StatusNotFound:
+		return &Error{Class: ErrorClassConfiguration, Err: fmt.Errorf("the API does not list DNS zones, check baseUrl: %w", err)}
+	case listErr != nil:
+		err = fmt.Errorf("zone %s is not in the Contabo account, and listing the account's zones failed (%v): %w", zone, listErr, err)
+	case len(zones) == 0:
+		err = fmt.Errorf("zone %s is not in the Contabo account, which has no DNS zones: %w", zone, err)
+	default:
+		listed := zones
+		if len(listed) > maxListedZones {
+			listed = listed[:maxListedZones]
+		}
+		list := strings.Join(listed, ", ")
+		if more := len(zones) - len(listed); more > 0 {
+			list += fmt.Sprintf(" and %d more", more)
+		}
+		err = fmt.Errorf("zone %s is not in the Contabo account, the closest match is %s (account zones: %s): %w", zone, closestZone(zone, zones), list, err)
+	}
+	return &Error{Class: ErrorClassZoneNotFound, Err: err}
+}
+
+// closestZone returns the zone of zones with the smallest edit distance to
+// zone.
+func closestZone(zone string, zones []string) string {
+	closest, best := "", -1
+	for _, candidate := range zones {
+		if d := editDistance(normalizeName(zone), normalizeName(candidate)); best < 0 || d < best {
+			closest, best = candidate, d
+		}
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
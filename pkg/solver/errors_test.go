@@ -0,0 +1,142 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+	"cert-manager-webhook-contabo/pkg/metrics"
+	"cert-manager-webhook-contabo/pkg/vault"
+)
+
+func TestClassOf(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want ErrorClass
+	}{
+		{&contabo.AuthError{StatusCode: http.StatusUnauthorized, Code: "invalid_grant"}, ErrorClassCredentials},
+		{&contabo.APIError{StatusCode: http.StatusUnauthorized}, ErrorClassCredentials},
+		{&contabo.APIError{StatusCode: http.StatusForbidden}, ErrorClassPermission},
+		{&contabo.APIError{StatusCode: http.StatusNotFound}, ErrorClassZoneNotFound},
+		{&contabo.APIError{StatusCode: http.StatusTooManyRequests}, ErrorClassRateLimited},
+		{&contabo.APIError{StatusCode: http.StatusBadGateway}, ErrorClassTransient},
+		{&contabo.APIError{StatusCode: http.StatusBadRequest}, ErrorClassConfiguration},
+		{fmt.Errorf("delete record 1: %w", &contabo.APIError{StatusCode: http.StatusForbidden}), ErrorClassPermission},
+		{fmt.Errorf("wrapped: %w", &Error{Class: ErrorClassConfiguration, Err: errors.New("bad")}), ErrorClassConfiguration},
+		{ErrNotConverged, ErrorClassTransient},
+	} {
+		if got := ClassOf(tc.err); got != tc.want {
+			t.Errorf("%v: expected class %s, got %s", tc.err, tc.want, got)
+		}
+	}
+	if !IsTransient(&contabo.APIError{StatusCode: http.StatusTooManyRequests}) || IsTransient(&contabo.APIError{StatusCode: http.StatusForbidden}) {
+		t.Errorf("expected only rate limited errors to be transient")
+	}
+}
+
+func TestZoneNotFoundListsAccountZones(t *testing.T) {
+	f := newFakeContabo(t, "exmaple.com")
+	f.zones = []string{"example.org", "example.com", "other.net"}
+	s, ch := newTestSolver(t, f, nil)
+
+	failures := testutil.ToFloat64(metrics.OperationErrors.WithLabelValues("Present", string(ErrorClassZoneNotFound)))
+	err := s.Present(ch)
+	var classified *Error
+	if !errors.As(err, &classified) || classified.Class != ErrorClassZoneNotFound || classified.Transient() {
+		t.Fatalf("expected a zone-not-found error, got %v", err)
+	}
+	for _, want := range []string{
+		"zone exmaple.com is not in the Contabo account",
+		"the closest match is example.com",
+		"account zones: example.org, example.com, other.net",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %v", want, err)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.OperationErrors.WithLabelValues("Present", string(ErrorClassZoneNotFound))) - failures; got != 1 {
+		t.Fatalf("expected 1 zone-not-found failure, got %v", got)
+	}
+}
+
+func TestErrorsClassifiedByCause(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(unavailable.Close)
+
+	f := newFakeContabo(t, "example.com")
+	for _, tc := range []struct {
+		name      string
+		configure func(*Config)
+		want      string
+	}{
+		{"outage", func(cfg *Config) { cfg.BaseURL = unavailable.URL }, "transient error, will be retried"},
+		{"wrong baseUrl", func(cfg *Config) { cfg.BaseURL = f.server.URL + "/v2" }, "configuration error: the API does not list DNS zones, check baseUrl"},
+		{"invalid config", func(cfg *Config) { cfg.TTL = 5 }, "configuration error: invalid config"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, ch := newTestSolver(t, f, tc.configure)
+			if err := s.Present(ch); err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+				t.Fatalf("expected error starting with %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestCredentialsErrorsClassifiedBySource(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	for _, tc := range []struct {
+		name      string
+		configure func(*Config)
+		getErr    error
+		want      ErrorClass
+	}{
+		{"missing secret", func(cfg *Config) { cfg.CredentialsSecretName = "missing" }, nil, ErrorClassCredentials},
+		{"denied namespace", func(cfg *Config) { cfg.CredentialsSecretNamespace = "other-ns" }, nil, ErrorClassPermission},
+		{"apiserver timeout", nil, apierrors.NewServerTimeout(schema.GroupResource{Resource: "secrets"}, "get", 1), ErrorClassTransient},
+		{"webhook not allowed to read secrets", nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "contabo-credentials", errors.New("rbac")), ErrorClassPermission},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, ch := newTestSolver(t, f, tc.configure)
+			if tc.getErr != nil {
+				s.client.(*kubefake.Clientset).PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tc.getErr
+				})
+			}
+			if err := s.Present(ch); ClassOf(err) != tc.want {
+				t.Fatalf("expected a %s error, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestVaultErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want ErrorClass
+	}{
+		{&vault.Error{StatusCode: http.StatusNotFound}, ErrorClassCredentials},
+		{&vault.Error{StatusCode: http.StatusForbidden}, ErrorClassPermission},
+		{&vault.Error{StatusCode: http.StatusServiceUnavailable}, ErrorClassTransient},
+		{&vault.Error{StatusCode: http.StatusBadRequest}, ErrorClassConfiguration},
+		{fmt.Errorf("vault read: %w", context.DeadlineExceeded), ErrorClassTransient},
+		{errors.New("vault read secret/data/x: secret has no data"), ErrorClassCredentials},
+	} {
+		if got := vaultErrorClass(tc.err); got != tc.want {
+			t.Errorf("%v: expected class %s, got %s", tc.err, tc.want, got)
+		}
+	}
+}
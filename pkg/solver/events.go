@@ -0,0 +1,201 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// Event reasons recorded on Challenges.
+const (
+	EventReasonRecordCreated        = "RecordCreated"
+	EventReasonRecordAlreadyPresent = "RecordAlreadyPresent"
+	EventReasonRecordDeleted        = "RecordDeleted"
+	EventReasonContaboAPIError      = "ContaboAPIError"
+	EventReasonCredentialsInvalid   = "CredentialsInvalid"
+	EventReasonConfigInvalid        = "ConfigInvalid"
+	EventReasonZoneNotFound         = "ZoneNotFound"
+	EventReasonPermissionDenied     = "PermissionDenied"
+	EventReasonRateLimited          = "RateLimited"
+)
+
+// errorEventReasons are the reasons of the events recorded for each class of
+// errors. Transient errors are recorded as ContaboAPIError.
+var errorEventReasons = map[ErrorClass]string{
+	ErrorClassConfiguration: EventReasonConfigInvalid,
+	ErrorClassCredentials:   EventReasonCredentialsInvalid,
+	ErrorClassZoneNotFound:  EventReasonZoneNotFound,
+	ErrorClassPermission:    EventReasonPermissionDenied,
+	ErrorClassRateLimited:   EventReasonRateLimited,
+	ErrorClassTransient:     EventReasonContaboAPIError,
+}
+
+const (
+	eventComponent     = "cert-manager-webhook-contabo"
+	eventLookupTimeout = 5 * time.Second
+	challengeUIDIndex  = "uid"
+)
+
+// newEventRecorder returns a recorder sending events to the API server until
+// stopCh is closed.
+func newEventRecorder(client kubernetes.Interface, stopCh <-chan struct{}) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	go func() {
+		<-stopCh
+		broadcaster.Shutdown()
+	}()
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+}
+
+// watchChallenges starts an informer holding the metadata of all Challenges
+// until stopCh is closed, so events find their Challenge without listing
+// them. Challenges of ClusterIssuers may live in any namespace.
+func (s *Solver) watchChallenges(stopCh <-chan struct{}) error {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(s.dynamic, 0)
+	informer := factory.ForResource(ChallengeGVR).Informer()
+	if err := informer.SetTransform(challengeMetadata); err != nil {
+		return fmt.Errorf("failed to set up challenge informer: %w", err)
+	}
+	err := informer.AddIndexers(cache.Indexers{challengeUIDIndex: func(obj any) ([]string, error) {
+		meta, ok := obj.(metav1.Object)
+		if !ok {
+			return nil, nil
+		}
+		return []string{string(meta.GetUID())}, nil
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to set up challenge informer: %w", err)
+	}
+	s.challenges = informer
+	factory.Start(stopCh)
+	return nil
+}
+
+// challengeMetadata keeps only what an event reference needs of a Challenge.
+func challengeMetadata(obj any) (any, error) {
+	item, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+	meta := &unstructured.Unstructured{}
+	meta.SetAPIVersion(item.GetAPIVersion())
+	meta.SetKind(item.GetKind())
+	meta.SetNamespace(item.GetNamespace())
+	meta.SetName(item.GetName())
+	meta.SetUID(item.GetUID())
+	meta.SetResourceVersion(item.GetResourceVersion())
+	return meta, nil
+}
+
+// event records an Event on the Challenge of ch. Events are best effort: a
+// Challenge that can't be found only means the event is dropped.
+func (s *Solver) event(ch *v1alpha1.ChallengeRequest, eventType, reason, messageFmt string, args ...any) {
+	if s.recorder == nil {
+		return
+	}
+	ref := s.challengeRef(ch)
+	if ref == nil {
+		return
+	}
+	s.recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
+
+// errorEvent records a warning event for err, which must be an *Error, and
+// returns it.
+func (s *Solver) errorEvent(ch *v1alpha1.ChallengeRequest, err *Error) error {
+	s.event(ch, corev1.EventTypeWarning, errorEventReasons[err.Class], "%v", err)
+	return err
+}
+
+// configError records a ConfigInvalid event for err and returns it classified.
+func (s *Solver) configError(ch *v1alpha1.ChallengeRequest, err error) error {
+	return s.errorEvent(ch, &Error{Class: ErrorClassConfiguration, Err: err})
+}
+
+// credentialsError records an event for a failure to load credentials, a
+// CredentialsInvalid event unless the failure has another class, and returns
+// it classified.
+func (s *Solver) credentialsError(ch *v1alpha1.ChallengeRequest, err error) error {
+	return s.errorEvent(ch, credentialsFailure(err))
+}
+
+// permissionError records a PermissionDenied event for err and returns it
+// classified.
+func (s *Solver) permissionError(ch *v1alpha1.ChallengeRequest, err error) error {
+	return s.errorEvent(ch, &Error{Class: ErrorClassPermission, Err: err})
+}
+
+// apiError records an event for an error of the Contabo API and returns it
+// classified by its status, such as CredentialsInvalid for rejected
+// credentials.
+func (s *Solver) apiError(ch *v1alpha1.ChallengeRequest, err error) error {
+	return s.errorEvent(ch, classify(err))
+}
+
+// challengeRef finds the Challenge resource of ch by UID, in the Challenge
+// informer once it has synced. Until then, and in tests without an informer,
+// Challenges of namespaced Issuers are looked up in the resource namespace;
+// those of ClusterIssuers in any namespace. Looked up references are cached
+// until CleanUp completes.
+func (s *Solver) challengeRef(ch *v1alpha1.ChallengeRequest) *corev1.ObjectReference {
+	if s.dynamic == nil || ch.UID == "" {
+		return nil
+	}
+	if ref, ok := s.challengeRefs.Load(ch.UID); ok {
+		return ref.(*corev1.ObjectReference)
+	}
+
+	if s.challenges != nil && s.challenges.HasSynced() {
+		items, err := s.challenges.GetIndexer().ByIndex(challengeUIDIndex, string(ch.UID))
+		if err == nil && len(items) > 0 {
+			if item, ok := items[0].(metav1.Object); ok {
+				return challengeObjectRef(item)
+			}
+		}
+		challengeLogger(ch).V(4).Info("Challenge not found, dropping event")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventLookupTimeout)
+	defer cancel()
+	for _, namespace := range []string{ch.ResourceNamespace, metav1.NamespaceAll} {
+		list, err := s.dynamic.Resource(ChallengeGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			challengeLogger(ch).V(4).Info("Failed to look up challenge", "err", err)
+			return nil
+		}
+		for i := range list.Items {
+			if list.Items[i].GetUID() != ch.UID {
+				continue
+			}
+			ref := challengeObjectRef(&list.Items[i])
+			s.challengeRefs.Store(ch.UID, ref)
+			return ref
+		}
+	}
+	challengeLogger(ch).V(4).Info("Challenge not found, dropping event")
+	return nil
+}
+
+func challengeObjectRef(item metav1.Object) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion:      fmt.Sprintf("%s/%s", ChallengeGVR.Group, ChallengeGVR.Version),
+		Kind:            "Challenge",
+		Namespace:       item.GetNamespace(),
+		Name:            item.GetName(),
+		UID:             item.GetUID(),
+		ResourceVersion: item.GetResourceVersion(),
+	}
+}
@@ -0,0 +1,138 @@
+package solver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventsRecordedOnChallenge(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	recorder := record.NewFakeRecorder(10)
+	s.recorder = recorder
+	s.dynamic = newFakeDynamic(newChallengeObject("tenant-ns", "challenge", "challenge-uid"))
+
+	for range 2 {
+		if err := s.Present(ch); err != nil {
+			t.Fatalf("present: %v", err)
+		}
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	events := drainEvents(recorder)
+	want := []string{"Normal RecordCreated", "Normal RecordAlreadyPresent", "Normal RecordDeleted"}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %v", len(want), events)
+	}
+	for i := range want {
+		if !strings.HasPrefix(events[i], want[i]) {
+			t.Fatalf("expected event %d to be %q, got %q", i, want[i], events[i])
+		}
+	}
+}
+
+func TestEventsFindChallengesInInformer(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	recorder := record.NewFakeRecorder(10)
+	s.recorder = recorder
+	dynamic := newFakeDynamic(newChallengeObject("app-ns", "challenge", "challenge-uid"))
+	s.dynamic = dynamic
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := s.watchChallenges(stopCh); err != nil {
+		t.Fatalf("watch challenges: %v", err)
+	}
+	if !cache.WaitForCacheSync(stopCh, s.challenges.HasSynced) {
+		t.Fatalf("challenge informer did not sync")
+	}
+	dynamic.ClearActions()
+
+	// The challenge lives outside the resource namespace, like those of
+	// ClusterIssuers.
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	events := drainEvents(recorder)
+	if len(events) != 1 || !strings.HasPrefix(events[0], "Normal RecordCreated") {
+		t.Fatalf("expected a RecordCreated event, got %v", events)
+	}
+	for _, action := range dynamic.Actions() {
+		if action.GetVerb() == "list" {
+			t.Fatalf("expected no challenges to be listed, got %v", dynamic.Actions())
+		}
+	}
+}
+
+func TestEventsForFailures(t *testing.T) {
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(unauthorized.Close)
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(unavailable.Close)
+
+	f := newFakeContabo(t, "example.com")
+	for _, tc := range []struct {
+		name      string
+		configure func(*Config)
+		reason    string
+	}{
+		{"missing secret", func(cfg *Config) { cfg.CredentialsSecretName = "missing" }, EventReasonCredentialsInvalid},
+		{"rejected credentials", func(cfg *Config) { cfg.AuthURL = unauthorized.URL }, EventReasonCredentialsInvalid},
+		{"api failure", func(cfg *Config) { cfg.BaseURL = unavailable.URL }, EventReasonContaboAPIError},
+		{"invalid config", func(cfg *Config) { cfg.TTL = 5 }, EventReasonConfigInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, ch := newTestSolver(t, f, tc.configure)
+			recorder := record.NewFakeRecorder(10)
+			s.recorder = recorder
+			s.dynamic = newFakeDynamic(newChallengeObject("tenant-ns", "challenge", "challenge-uid"))
+
+			if err := s.Present(ch); err == nil {
+				t.Fatalf("expected present to fail")
+			}
+			events := drainEvents(recorder)
+			if len(events) != 1 || !strings.HasPrefix(events[0], "Warning "+tc.reason) {
+				t.Fatalf("expected a %s warning, got %v", tc.reason, events)
+			}
+		})
+	}
+}
+
+func TestEventsDroppedWithoutChallenge(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	recorder := record.NewFakeRecorder(10)
+	s.recorder = recorder
+	s.dynamic = newFakeDynamic()
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if events := drainEvents(recorder); len(events) != 0 {
+		t.Fatalf("expected no events, got %v", events)
+	}
+}
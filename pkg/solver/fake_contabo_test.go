@@ -0,0 +1,229 @@
+package solver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+// fakeContabo is a stateful fake of the Contabo DNS API. Records live in zone
+// unless added with addIn. Writes become visible to ListRecords only after
+// lag further list calls, or never if frozen is set.
+type fakeContabo struct {
+	t      *testing.T
+	zone   string
+	server *httptest.Server
+
+	mu      sync.Mutex
+	lag     int
+	frozen  bool
+	nextID  int64
+	lists   int
+	creates int
+	deletes int
+	records []fakeRecord
+	// zones, when set, are the zones of the account. Requests for any
+	// other zone are answered with 404 Not Found.
+	zones []string
+}
+
+type fakeRecord struct {
+	contabo.DNSRecord
+	zone      string
+	visibleAt int
+	deletedAt int
+}
+
+func newFakeContabo(t *testing.T, zone string) *fakeContabo {
+	f := &fakeContabo{t: t, zone: zone, nextID: 1}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token123","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/dns/zones", f.handleZones)
+	mux.HandleFunc("/v1/dns/zones/{zone}/records", f.handleRecords)
+	mux.HandleFunc("/v1/dns/zones/{zone}/records/{id}", f.handleRecord)
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// add inserts a record that is immediately visible.
+func (f *fakeContabo) add(record contabo.DNSRecord) int64 {
+	return f.addIn(f.zone, record)
+}
+
+// addIn inserts a record into zone that is immediately visible.
+func (f *fakeContabo) addIn(zone string, record contabo.DNSRecord) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	record.RecordID = f.nextID
+	f.nextID++
+	f.records = append(f.records, fakeRecord{DNSRecord: record, zone: zone})
+	return record.RecordID
+}
+
+// visible returns the records a ListRecords call would currently return.
+func (f *fakeContabo) visible() []contabo.DNSRecord {
+	return f.visibleIn(f.zone)
+}
+
+// visibleIn returns the records of zone a ListRecords call would currently
+// return.
+func (f *fakeContabo) visibleIn(zone string) []contabo.DNSRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.visibleLocked(zone)
+}
+
+func (f *fakeContabo) visibleLocked(zone string) []contabo.DNSRecord {
+	var out []contabo.DNSRecord
+	for _, r := range f.records {
+		if r.zone == zone && f.lists >= r.visibleAt && (r.deletedAt == 0 || f.lists < r.deletedAt) {
+			out = append(out, r.DNSRecord)
+		}
+	}
+	return out
+}
+
+func (f *fakeContabo) handleZones(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zones := []map[string]string{}
+	for _, zone := range f.zones {
+		zones = append(zones, map[string]string{"zoneName": zone})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": zones, "_pagination": map[string]int{"totalPages": 1}})
+}
+
+func (f *fakeContabo) handleRecords(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.zones != nil && !slices.Contains(f.zones, r.PathValue("zone")) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"Entry DnsZone not found"}`))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		f.lists++
+		search := r.URL.Query().Get("search")
+		records := []contabo.DNSRecord{}
+		for _, record := range f.visibleLocked(r.PathValue("zone")) {
+			if search == "" || strings.Contains(record.Name, search) {
+				records = append(records, record)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": records})
+	case http.MethodPost:
+		var req contabo.CreateRecordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Errorf("decode create: %v", err)
+		}
+		f.creates++
+		f.records = append(f.records, fakeRecord{
+			DNSRecord: contabo.DNSRecord{RecordID: f.nextID, Name: req.Name, Type: req.Type, Data: req.Data, TTL: req.TTL, Prio: req.Prio},
+			zone:      r.PathValue("zone"),
+			visibleAt: f.applyAt(),
+		})
+		f.nextID++
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeContabo) handleRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.records {
+		if f.records[i].RecordID == id && f.records[i].zone == r.PathValue("zone") && f.records[i].deletedAt == 0 {
+			f.deletes++
+			f.records[i].deletedAt = f.applyAt()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// applyAt returns the list call count from which a write becomes visible. With
+// lag 0 a write is visible right away, with lag n on the n-th list call after
+// it.
+func (f *fakeContabo) applyAt() int {
+	if f.frozen {
+		return int(^uint(0) >> 1)
+	}
+	return f.lists + f.lag
+}
+
+// newTestSolver returns a Solver with a credentials Secret in tenant-ns and a
+// challenge for _acme-challenge.<zone> configured against f.
+func newTestSolver(t *testing.T, f *fakeContabo, configure func(*Config)) (*Solver, *v1alpha1.ChallengeRequest) {
+	t.Helper()
+
+	cfg := Config{
+		CredentialsSecretName: "contabo-credentials",
+		BaseURL:               f.server.URL,
+		AuthURL:               f.server.URL + "/token",
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	cfgJSON, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "contabo-credentials", Namespace: "tenant-ns"},
+		Data: map[string][]byte{
+			secretKeyClientID:     []byte("id"),
+			secretKeyClientSecret: []byte("secret"),
+			secretKeyUsername:     []byte("user"),
+			secretKeyPassword:     []byte("pass"),
+		},
+	}
+
+	s := NewSolver()
+	s.client = kubefake.NewSimpleClientset(secret)
+
+	ch := &v1alpha1.ChallengeRequest{
+		UID:               "challenge-uid",
+		ResourceNamespace: "tenant-ns",
+		ResolvedZone:      f.zone + ".",
+		ResolvedFQDN:      "_acme-challenge." + f.zone + ".",
+		Key:               "key",
+		Config:            &apiextensionsv1.JSON{Raw: cfgJSON},
+	}
+	return s, ch
+}
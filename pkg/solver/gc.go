@@ -0,0 +1,239 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"cert-manager-webhook-contabo/pkg/audit"
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+// ChallengeGVR identifies cert-manager's Challenge resource.
+var ChallengeGVR = schema.GroupVersionResource{Group: "acme.cert-manager.io", Version: "v1", Resource: "challenges"}
+
+const defaultGCMinAge = time.Hour
+
+// GCOptions configures the garbage collector for orphaned ACME TXT records.
+type GCOptions struct {
+	// Interval between sweeps.
+	Interval time.Duration
+	// MinAge is how old a record must be before it is collected.
+	MinAge time.Duration
+	// Zones limits collection to these zones. Empty means every zone in the
+	// ledger.
+	Zones []string
+	// DryRun only reports what would be deleted.
+	DryRun bool
+}
+
+// WithGarbageCollector periodically deletes TXT records from the ledger whose
+// Challenge no longer exists. Records created by other clusters or by hand
+// are never in this cluster's ledger and are left alone.
+func WithGarbageCollector(opts GCOptions) Option {
+	return func(s *Solver) {
+		if opts.MinAge <= 0 {
+			opts.MinAge = defaultGCMinAge
+		}
+		for i, zone := range opts.Zones {
+			opts.Zones[i] = normalizeName(zone)
+		}
+		s.gc = &opts
+	}
+}
+
+func (s *Solver) runGarbageCollector(stopCh <-chan struct{}) {
+	klog.Infof("starting garbage collector: interval=%s minAge=%s zones=%v dryRun=%v", s.gc.Interval, s.gc.MinAge, s.gc.Zones, s.gc.DryRun)
+	wait.Until(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.gc.Interval)
+		defer cancel()
+		if err := s.collectGarbage(ctx); err != nil {
+			klog.Errorf("garbage collection failed: %v", err)
+		}
+	}, s.gc.Interval, stopCh)
+}
+
+// collectGarbage runs a single sweep.
+func (s *Solver) collectGarbage(ctx context.Context) error {
+	entries, err := s.ledger.list(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	live, err := s.liveChallengeUIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var errs []error
+	var orphaned, kept int
+	for _, entry := range entries {
+		if !s.gc.coversZone(entry.Zone) {
+			continue
+		}
+		age := now.Sub(entry.CreatedAt)
+		if live[entry.ChallengeUID] || age < s.gc.MinAge || !entry.deletionDue(now) {
+			kept++
+			continue
+		}
+		orphaned++
+
+		if s.gc.DryRun {
+			klog.InfoS("Garbage collector dry run: would delete orphaned TXT record",
+				"zone", entry.Zone, "fqdn", entry.FQDN, "recordID", entry.RecordID,
+				"challengeUID", entry.ChallengeUID, "age", age.Round(time.Second))
+			continue
+		}
+
+		if err := s.deleteLedgerRecord(ctx, entry); err != nil {
+			errs = append(errs, fmt.Errorf("challenge %s: %w", entry.ChallengeUID, err))
+			continue
+		}
+		klog.InfoS("Garbage collector deleted orphaned TXT record",
+			"zone", entry.Zone, "fqdn", entry.FQDN, "recordID", entry.RecordID,
+			"challengeUID", entry.ChallengeUID, "age", age.Round(time.Second))
+	}
+
+	if s.gc.DryRun {
+		s.reportUnowned(ctx, entries)
+	}
+	klog.Infof("garbage collection finished: %d orphaned, %d kept, %d failed, dryRun=%v", orphaned, kept, len(errs), s.gc.DryRun)
+
+	return errors.Join(errs...)
+}
+
+// deleteLedgerRecord deletes the record described by entry using the
+// credentials of the Issuer that created it, then drops the entry.
+func (s *Solver) deleteLedgerRecord(ctx context.Context, entry ledgerEntry) error {
+	client, creds, recordName, err := s.clientForLedgerEntry(ctx, entry)
+	if err != nil {
+		return err
+	}
+	defer s.locks.lock(entry.Zone, recordName)()
+	ctx, unlock, err := s.lockZone(ctx, creds, entry.Zone)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ids := []int64{entry.RecordID}
+	if entry.RecordID == 0 {
+		records, err := client.ListRecords(ctx, entry.Zone, recordName)
+		if err != nil {
+			return err
+		}
+		ids = ids[:0]
+		for _, record := range records {
+			if entry.matches(record, recordName) {
+				ids = append(ids, record.RecordID)
+			}
+		}
+	}
+	ch := entry.challengeRequest()
+	for _, id := range ids {
+		err := client.DeleteRecord(ctx, entry.Zone, fmt.Sprint(id))
+		s.recordAudit(ctx, ch, creds, audit.ActionDelete, auditReasonGC, entry.Zone, recordName, "TXT", id, err)
+		if err != nil {
+			return fmt.Errorf("delete record %d: %w", id, err)
+		}
+	}
+
+	return s.ledger.remove(ctx, s.client, entry.ChallengeUID)
+}
+
+func (s *Solver) clientForLedgerEntry(ctx context.Context, entry ledgerEntry) (*contabo.Client, *credentials, string, error) {
+	p := s.profileNamed(entry.Profile)
+	if p == nil {
+		return nil, nil, "", fmt.Errorf("solver %s is no longer served", entry.Profile)
+	}
+	ch := entry.challengeRequest()
+	cfg, err := s.loadConfig(withProfile(ctx, p), ch.Config)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	creds, err := s.loadCredentials(ctx, ch, cfg)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err := creds.authorize(entry.Zone, entry.FQDN); err != nil {
+		return nil, nil, "", err
+	}
+	client, err := s.newClient(cfg, creds)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return client, creds, relativeRecordName(entry.FQDN, entry.Zone), nil
+}
+
+// reportUnowned logs ACME TXT records in the collected zones that are not in
+// the ledger. They belong to other clusters or were added by hand, so the
+// collector never deletes them.
+func (s *Solver) reportUnowned(ctx context.Context, entries []ledgerEntry) {
+	scanned := map[string]bool{}
+	for _, entry := range entries {
+		if scanned[entry.Zone] || !s.gc.coversZone(entry.Zone) {
+			continue
+		}
+		scanned[entry.Zone] = true
+
+		client, _, _, err := s.clientForLedgerEntry(ctx, entry)
+		if err != nil {
+			klog.Warningf("garbage collector dry run: cannot scan zone %s: %v", entry.Zone, err)
+			continue
+		}
+		records, err := client.ListRecords(ctx, entry.Zone, "_acme-challenge")
+		if err != nil {
+			klog.Warningf("garbage collector dry run: cannot scan zone %s: %v", entry.Zone, err)
+			continue
+		}
+		for _, record := range records {
+			if !strings.EqualFold(record.Type, "TXT") || !strings.HasPrefix(record.Name, "_acme-challenge") {
+				continue
+			}
+			owned := slices.ContainsFunc(entries, func(e ledgerEntry) bool {
+				return e.Zone == entry.Zone && e.matches(record, relativeRecordName(e.FQDN, e.Zone))
+			})
+			if !owned {
+				klog.InfoS("Garbage collector dry run: ignoring TXT record not owned by this cluster",
+					"zone", entry.Zone, "name", record.Name, "recordID", record.RecordID)
+			}
+		}
+	}
+}
+
+// liveChallengeUIDs returns the UIDs of all Challenge resources in the cluster.
+func (s *Solver) liveChallengeUIDs(ctx context.Context) (map[string]bool, error) {
+	if s.dynamic == nil {
+		return nil, fmt.Errorf("dynamic client is not initialized")
+	}
+	list, err := s.dynamic.Resource(ChallengeGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list challenges: %w", err)
+	}
+	uids := make(map[string]bool, len(list.Items))
+	for _, item := range list.Items {
+		uids[string(item.GetUID())] = true
+	}
+	return uids, nil
+}
+
+// matches reports whether record is the one described by the entry, by ID when
+// known and by name and value otherwise.
+func (e *ledgerEntry) matches(record contabo.DNSRecord, recordName string) bool {
+	if e.RecordID != 0 {
+		return record.RecordID == e.RecordID
+	}
+	return isACMERecord(record, recordName, e.Value)
+}
+
+func (o *GCOptions) coversZone(zone string) bool {
+	return len(o.Zones) == 0 || slices.Contains(o.Zones, normalizeName(zone))
+}
@@ -0,0 +1,111 @@
+package solver
+
+import (
+	"context"
+	"testing"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+func newChallengeObject(namespace, name, uid string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("acme.cert-manager.io/v1")
+	obj.SetKind("Challenge")
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetUID(types.UID(uid))
+	return obj
+}
+
+func newFakeDynamic(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ChallengeGVR: "ChallengeList"}, objects...)
+}
+
+func TestGarbageCollectorDeletesOrphanedRecords(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "other-cluster"})
+
+	s, live := newTestSolver(t, f, nil)
+	WithLedger("webhook-ns")(s)
+	WithGarbageCollector(GCOptions{MinAge: 1})(s)
+	s.dynamic = newFakeDynamic(newChallengeObject("tenant-ns", "live", "uid-live"))
+
+	live.UID = "uid-live"
+	live.Key = "live-key"
+	orphan := *live
+	orphan.UID = "uid-orphan"
+	orphan.Key = "orphan-key"
+	for _, ch := range []*v1alpha1.ChallengeRequest{live, &orphan} {
+		if err := s.Present(ch); err != nil {
+			t.Fatalf("present %s: %v", ch.UID, err)
+		}
+	}
+
+	s.gc.DryRun = true
+	if err := s.collectGarbage(context.Background()); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if f.deletes != 0 {
+		t.Fatalf("expected dry run not to delete, got %d deletes", f.deletes)
+	}
+
+	s.gc.DryRun = false
+	if err := s.collectGarbage(context.Background()); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	var values []string
+	for _, record := range f.visible() {
+		values = append(values, record.Data)
+	}
+	if len(values) != 2 || values[0] != "other-cluster" || values[1] != "live-key" {
+		t.Fatalf("expected only the orphaned record to be deleted, got %v", values)
+	}
+
+	entries, err := s.ledger.list(context.Background(), s.client)
+	if err != nil {
+		t.Fatalf("list ledger: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ChallengeUID != "uid-live" {
+		t.Fatalf("expected only the live challenge in the ledger, got %+v", entries)
+	}
+}
+
+func TestGarbageCollectorRespectsMinAgeAndZones(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	WithLedger("webhook-ns")(s)
+	s.dynamic = newFakeDynamic()
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+
+	WithGarbageCollector(GCOptions{})(s)
+	if err := s.collectGarbage(context.Background()); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	WithGarbageCollector(GCOptions{MinAge: 1, Zones: []string{"example.org."}})(s)
+	if err := s.collectGarbage(context.Background()); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if f.deletes != 0 {
+		t.Fatalf("expected young or out-of-scope records to be kept, got %d deletes", f.deletes)
+	}
+
+	WithGarbageCollector(GCOptions{MinAge: 1, Zones: []string{"Example.com."}})(s)
+	if err := s.collectGarbage(context.Background()); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if f.deletes != 1 {
+		t.Fatalf("expected record to be collected, got %d deletes", f.deletes)
+	}
+}
@@ -0,0 +1,266 @@
+package solver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultLeaseDuration is how long a zone lock is held without renewal.
+	DefaultLeaseDuration = 15 * time.Second
+
+	leasePrefix         = "cert-manager-webhook-contabo-"
+	leaseZoneAnnotation = "acme.contabo.com/zone"
+)
+
+// leaseLocker provides locks per Contabo account and zone shared by all
+// webhook replicas, using coordination.k8s.io Leases. A lock whose holder
+// stops renewing it expires after duration and can be taken over.
+//
+// A Lease only tells replicas apart, so callers within this replica are
+// serialised per Lease name by held before they touch the Lease.
+type leaseLocker struct {
+	namespace string
+	identity  string
+	duration  time.Duration
+	// retryInterval is how often a held lock is polled.
+	retryInterval time.Duration
+	now           func() time.Time
+
+	mu   sync.Mutex
+	held map[string]chan struct{}
+}
+
+// WithLeaseLocks serialises record changes in a zone across replicas with
+// Leases in namespace, normally the webhook's own. identity must be unique
+// per replica, e.g. the pod name.
+func WithLeaseLocks(namespace, identity string, duration time.Duration) Option {
+	return func(s *Solver) {
+		if duration <= 0 {
+			duration = DefaultLeaseDuration
+		}
+		s.leases = &leaseLocker{
+			namespace:     namespace,
+			identity:      identity,
+			duration:      duration,
+			retryInterval: duration / 10,
+			now:           time.Now,
+		}
+	}
+}
+
+// lockZone takes the Lease lock for the credentials' account and zone, if
+// Lease locks are enabled, and returns the function releasing it. The
+// returned context is cancelled when the lock is lost, and must be used for
+// all changes made under it.
+func (s *Solver) lockZone(ctx context.Context, creds *credentials, zone string) (context.Context, func(), error) {
+	if s.leases == nil {
+		return ctx, func() {}, nil
+	}
+	return s.leases.acquire(ctx, s.client, leaseName(creds.clientID, zone), zone)
+}
+
+// leaseName derives a stable Lease name from the account and zone without
+// exposing the client ID.
+func leaseName(account, zone string) string {
+	sum := sha256.Sum256([]byte(account + "/" + normalizeName(zone)))
+	return leasePrefix + hex.EncodeToString(sum[:8])
+}
+
+// acquire blocks until the Lease name is held by this caller or ctx is done.
+// The Lease is renewed in the background until the returned function is
+// called; if a renewal fails, the returned context is cancelled.
+func (l *leaseLocker) acquire(ctx context.Context, client kubernetes.Interface, name, zone string) (context.Context, func(), error) {
+	slot := l.slot(name)
+	select {
+	case slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("timed out waiting for lock on zone %s held by another challenge: %w", zone, ctx.Err())
+	}
+
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := l.tryAcquire(ctx, client, name, zone)
+		if err != nil {
+			<-slot
+			return nil, nil, err
+		}
+		if acquired {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			<-slot
+			return nil, nil, fmt.Errorf("timed out waiting for lock on zone %s held by another replica: %w", zone, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	heldCtx, cancel := context.WithCancelCause(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.renew(client, name, stop, cancel)
+	}()
+
+	return heldCtx, func() {
+		close(stop)
+		<-done
+		cancel(nil)
+		l.release(client, name)
+		<-slot
+	}, nil
+}
+
+// slot returns the channel that admits one caller of this replica at a time
+// to the Lease name.
+func (l *leaseLocker) slot(name string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held == nil {
+		l.held = make(map[string]chan struct{})
+	}
+	slot, ok := l.held[name]
+	if !ok {
+		slot = make(chan struct{}, 1)
+		l.held[name] = slot
+	}
+	return slot
+}
+
+// tryAcquire takes the Lease if it is free, expired or already ours.
+func (l *leaseLocker) tryAcquire(ctx context.Context, client kubernetes.Interface, name, zone string) (bool, error) {
+	leases := client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(l.now())
+	seconds := int32(l.duration / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   l.namespace,
+				Annotations: map[string]string{leaseZoneAnnotation: zone},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to create lease %s/%s: %w", l.namespace, name, err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read lease %s/%s: %w", l.namespace, name, err)
+	}
+
+	if !l.available(lease) {
+		return false, nil
+	}
+	lease.Spec.HolderIdentity = &l.identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update lease %s/%s: %w", l.namespace, name, err)
+	}
+	return true, nil
+}
+
+func (l *leaseLocker) available(lease *coordinationv1.Lease) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || *spec.HolderIdentity == l.identity {
+		return true
+	}
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+	return l.now().After(expiry)
+}
+
+// renew keeps the Lease held until stop is closed. When a renewal fails the
+// lock may already belong to another replica, so the holder is cancelled
+// with lost rather than left to carry on unprotected.
+func (l *leaseLocker) renew(client kubernetes.Interface, name string, stop <-chan struct{}, lost context.CancelCauseFunc) {
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		err := l.updateHeld(client, name, func(lease *coordinationv1.Lease) {
+			now := metav1.NewMicroTime(l.now())
+			lease.Spec.RenewTime = &now
+		})
+		if err != nil {
+			klog.Warningf("failed to renew lease %s/%s, giving up the lock: %v", l.namespace, name, err)
+			lost(fmt.Errorf("lost lease %s/%s: %w", l.namespace, name, err))
+			return
+		}
+	}
+}
+
+// release clears the holder so other replicas don't have to wait for the
+// Lease to expire. Failures are only logged; the Lease expires regardless.
+func (l *leaseLocker) release(client kubernetes.Interface, name string) {
+	err := l.updateHeld(client, name, func(lease *coordinationv1.Lease) {
+		lease.Spec.HolderIdentity = nil
+		lease.Spec.AcquireTime = nil
+		lease.Spec.RenewTime = nil
+	})
+	if err != nil {
+		klog.Warningf("failed to release lease %s/%s: %v", l.namespace, name, err)
+	}
+}
+
+// updateHeld applies mutate to the Lease if this replica still holds it.
+func (l *leaseLocker) updateHeld(client kubernetes.Interface, name string, mutate func(*coordinationv1.Lease)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.duration)
+	defer cancel()
+
+	leases := client.CoordinationV1().Leases(l.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.identity {
+			return fmt.Errorf("lease is held by another replica")
+		}
+		mutate(lease)
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,201 @@
+package solver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLeaseLocker(identity string, duration time.Duration) *leaseLocker {
+	s := &Solver{}
+	WithLeaseLocks("webhook-ns", identity, duration)(s)
+	return s.leases
+}
+
+func TestLeaseLockExcludesOtherReplicas(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	a := newTestLeaseLocker("replica-a", time.Minute)
+	b := newTestLeaseLocker("replica-b", time.Minute)
+	name := leaseName("account", "example.com")
+
+	_, release, err := a.acquire(context.Background(), client, name, "example.com")
+	if err != nil {
+		t.Fatalf("acquire a: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := b.acquire(ctx, client, name, "example.com"); err == nil {
+		t.Fatalf("expected replica b to wait while replica a holds the lock")
+	}
+
+	// Other zones and accounts are not blocked.
+	_, releaseOther, err := b.acquire(context.Background(), client, leaseName("account", "example.org"), "example.org")
+	if err != nil {
+		t.Fatalf("acquire other zone: %v", err)
+	}
+	releaseOther()
+
+	release()
+	_, releaseB, err := b.acquire(context.Background(), client, name, "example.com")
+	if err != nil {
+		t.Fatalf("acquire b after release: %v", err)
+	}
+	releaseB()
+}
+
+func TestLeaseLockTakesOverExpiredLease(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	a := newTestLeaseLocker("replica-a", time.Minute)
+	b := newTestLeaseLocker("replica-b", time.Minute)
+	name := leaseName("account", "example.com")
+
+	// Replica a crashes while holding the lock.
+	if ok, err := a.tryAcquire(context.Background(), client, name, "example.com"); err != nil || !ok {
+		t.Fatalf("acquire a: %v %v", ok, err)
+	}
+	if ok, _ := b.tryAcquire(context.Background(), client, name, "example.com"); ok {
+		t.Fatalf("expected the lease to be held")
+	}
+
+	b.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if ok, err := b.tryAcquire(context.Background(), client, name, "example.com"); err != nil || !ok {
+		t.Fatalf("expected replica b to take over the expired lease: %v %v", ok, err)
+	}
+}
+
+func TestLeaseLockRenews(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	a := newTestLeaseLocker("replica-a", 300*time.Millisecond)
+	name := leaseName("account", "example.com")
+
+	_, release, err := a.acquire(context.Background(), client, name, "example.com")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	lease, err := client.CoordinationV1().Leases("webhook-ns").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get lease: %v", err)
+	}
+	acquired := lease.Spec.RenewTime.Time
+
+	time.Sleep(250 * time.Millisecond)
+	lease, err = client.CoordinationV1().Leases("webhook-ns").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get lease: %v", err)
+	}
+	if !lease.Spec.RenewTime.After(acquired) {
+		t.Fatalf("expected the lease to be renewed")
+	}
+	if lease.Annotations[leaseZoneAnnotation] != "example.com" {
+		t.Fatalf("expected zone annotation, got %v", lease.Annotations)
+	}
+
+	release()
+	lease, err = client.CoordinationV1().Leases("webhook-ns").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get lease: %v", err)
+	}
+	if lease.Spec.HolderIdentity != nil {
+		t.Fatalf("expected the lease to be released, held by %q", *lease.Spec.HolderIdentity)
+	}
+}
+
+func TestLeaseLockExcludesCallersOfTheSameReplica(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	a := newTestLeaseLocker("replica-a", time.Minute)
+	name := leaseName("account", "example.com")
+
+	_, release, err := a.acquire(context.Background(), client, name, "example.com")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := a.acquire(ctx, client, name, "example.com"); err == nil {
+		t.Fatalf("expected a second challenge of the same replica to wait")
+	}
+
+	acquired := make(chan func())
+	go func() {
+		_, releaseSecond, err := a.acquire(context.Background(), client, name, "example.com")
+		if err != nil {
+			t.Errorf("acquire second: %v", err)
+		}
+		acquired <- releaseSecond
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("expected the second challenge to wait for the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Releasing the first lock must not release the Lease under the second.
+	release()
+	releaseSecond := <-acquired
+	lease, err := client.CoordinationV1().Leases("webhook-ns").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get lease: %v", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != "replica-a" {
+		t.Fatalf("expected the lease to stay held for the second challenge, got %v", lease.Spec.HolderIdentity)
+	}
+	releaseSecond()
+}
+
+func TestLeaseLockCancelsHolderWhenLost(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	a := newTestLeaseLocker("replica-a", 300*time.Millisecond)
+	name := leaseName("account", "example.com")
+
+	ctx, release, err := a.acquire(context.Background(), client, name, "example.com")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+
+	// Another replica takes over, e.g. after this one was paused too long.
+	lease, err := client.CoordinationV1().Leases("webhook-ns").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get lease: %v", err)
+	}
+	other := "replica-b"
+	lease.Spec.HolderIdentity = &other
+	if _, err := client.CoordinationV1().Leases("webhook-ns").Update(context.Background(), lease, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update lease: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("expected the holder's context to be cancelled after a failed renewal")
+	}
+	if cause := context.Cause(ctx); cause == nil || !strings.Contains(cause.Error(), "lost lease") {
+		t.Fatalf("expected the lost lease as cause, got %v", cause)
+	}
+}
+
+func TestPresentWithLeaseLocks(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	WithLeaseLocks("webhook-ns", "replica-a", time.Minute)(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	leases, err := s.client.CoordinationV1().Leases("webhook-ns").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list leases: %v", err)
+	}
+	if len(leases.Items) != 1 || leases.Items[0].Spec.HolderIdentity != nil {
+		t.Fatalf("expected one released lease, got %+v", leases.Items)
+	}
+}
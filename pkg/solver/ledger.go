@@ -0,0 +1,316 @@
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+	"cert-manager-webhook-contabo/pkg/metrics"
+)
+
+// LedgerConfigMapName is the name of the ConfigMap holding the ledger.
+const LedgerConfigMapName = "cert-manager-webhook-contabo-ledger"
+
+// Ledger entry states.
+const (
+	// ledgerStatePending is recorded before the create call, so a crash before
+	// the record ID is known still leaves a trace of the record.
+	ledgerStatePending = "Pending"
+	// ledgerStatePresent means the record was created and, if the API listed
+	// it in time, its ID is known.
+	ledgerStatePresent = "Present"
+	// ledgerStateCleanupScheduled means CleanUp was called with a
+	// cleanupDelay and the record is deleted at DeleteAfter.
+	ledgerStateCleanupScheduled = "CleanupScheduled"
+)
+
+// ledgerEntry describes a TXT record created by this webhook. Entries carry
+// everything needed to delete the record again without the original
+// ChallengeRequest.
+type ledgerEntry struct {
+	ChallengeUID            string          `json:"challengeUID"`
+	ResourceNamespace       string          `json:"resourceNamespace"`
+	IssuerKind              string          `json:"issuerKind"`
+	AllowAmbientCredentials bool            `json:"allowAmbientCredentials,omitempty"`
+	Zone                    string          `json:"zone"`
+	FQDN                    string          `json:"fqdn"`
+	RecordName              string          `json:"recordName"`
+	RecordID                int64           `json:"recordId"`
+	Value                   string          `json:"value"`
+	State                   string          `json:"state"`
+	Config                  json.RawMessage `json:"config"`
+	// Profile is the solverName of the challenge, empty for the default.
+	Profile     string     `json:"profile,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	DeleteAfter *time.Time `json:"deleteAfter,omitempty"`
+}
+
+// ledger persists ledgerEntries, keyed by challenge UID, in a ConfigMap.
+// Because the ledger lives in the cluster, it only ever lists records created
+// by this cluster, even when several clusters share a Contabo account.
+type ledger struct {
+	namespace string
+	name      string
+}
+
+// WithLedger records every TXT record the webhook creates in a ConfigMap in
+// namespace, normally the webhook's own.
+func WithLedger(namespace string) Option {
+	return func(s *Solver) {
+		s.ledger = &ledger{namespace: namespace, name: LedgerConfigMapName}
+	}
+}
+
+func (l *ledger) put(ctx context.Context, client kubernetes.Interface, entry ledgerEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return l.update(ctx, client, func(data map[string]string) {
+		data[entry.ChallengeUID] = string(b)
+	})
+}
+
+func (l *ledger) remove(ctx context.Context, client kubernetes.Interface, challengeUID string) error {
+	return l.update(ctx, client, func(data map[string]string) {
+		delete(data, challengeUID)
+	})
+}
+
+func (l *ledger) get(ctx context.Context, client kubernetes.Interface, challengeUID string) (*ledgerEntry, error) {
+	entries, err := l.list(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].ChallengeUID == challengeUID {
+			return &entries[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// list returns all entries ordered by creation time.
+func (l *ledger) list(ctx context.Context, client kubernetes.Interface) ([]ledgerEntry, error) {
+	cm, err := client.CoreV1().ConfigMaps(l.namespace).Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger %s/%s: %w", l.namespace, l.name, err)
+	}
+
+	entries := make([]ledgerEntry, 0, len(cm.Data))
+	for key, value := range cm.Data {
+		var entry ledgerEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode ledger entry %s: %w", key, err)
+		}
+		entries = append(entries, entry)
+	}
+	observeManagedRecords(entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+func (l *ledger) update(ctx context.Context, client kubernetes.Interface, mutate func(map[string]string)) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := client.CoreV1().ConfigMaps(l.namespace).Get(ctx, l.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: l.name, Namespace: l.namespace},
+				Data:       map[string]string{},
+			}
+			mutate(cm.Data)
+			if len(cm.Data) == 0 {
+				return nil
+			}
+			_, err = client.CoreV1().ConfigMaps(l.namespace).Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), l.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		mutate(cm.Data)
+		if _, err = client.CoreV1().ConfigMaps(l.namespace).Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		entries := make([]ledgerEntry, 0, len(cm.Data))
+		for _, value := range cm.Data {
+			var entry ledgerEntry
+			if json.Unmarshal([]byte(value), &entry) == nil {
+				entries = append(entries, entry)
+			}
+		}
+		observeManagedRecords(entries)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update ledger %s/%s: %w", l.namespace, l.name, err)
+	}
+	return nil
+}
+
+// observeManagedRecords sets the managed records gauge from the entries of
+// the ledger.
+func observeManagedRecords(entries []ledgerEntry) {
+	counts := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		counts[entry.Zone]++
+	}
+	metrics.ManagedRecords.Reset()
+	for zone, count := range counts {
+		metrics.ManagedRecords.WithLabelValues(zone).Set(float64(count))
+	}
+}
+
+// markPending records that a TXT record is about to be created for ch.
+func (s *Solver) markPending(ctx context.Context, ch *v1alpha1.ChallengeRequest, zone, recordName string) error {
+	if s.ledger == nil || ch.UID == "" {
+		return nil
+	}
+
+	existing, err := s.ledger.get(ctx, s.client, string(ch.UID))
+	if err != nil {
+		return err
+	}
+	entry := s.newLedgerEntry(ctx, ch, zone, recordName, existing)
+	entry.State = ledgerStatePending
+	if err := s.ledger.put(ctx, s.client, entry); err != nil {
+		return fmt.Errorf("refusing to create TXT record %s in zone %s without a ledger entry: %w", recordName, zone, err)
+	}
+	return nil
+}
+
+// recordInLedger stores the presented record in the ledger. recordID is 0 when
+// the record was just created; it is then looked up, and left 0 if the API
+// doesn't list the record yet, in which case it is matched by name and value.
+func (s *Solver) recordInLedger(ctx context.Context, client *contabo.Client, ch *v1alpha1.ChallengeRequest, zone, recordName string, recordID int64) error {
+	if s.ledger == nil || ch.UID == "" {
+		return nil
+	}
+
+	if recordID == 0 {
+		recordID = findRecordID(ctx, client, zone, recordName, ch.Key)
+	}
+
+	existing, err := s.ledger.get(ctx, s.client, string(ch.UID))
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.State == ledgerStatePresent && existing.RecordID == recordID {
+		return nil
+	}
+
+	entry := s.newLedgerEntry(ctx, ch, zone, recordName, existing)
+	entry.State = ledgerStatePresent
+	entry.RecordID = recordID
+	if err := s.ledger.put(ctx, s.client, entry); err != nil {
+		return fmt.Errorf("TXT record %s in zone %s was created but could not be recorded: %w", recordName, zone, err)
+	}
+	klog.FromContext(ctx).V(2).Info("Recorded TXT record in ledger", "recordName", recordName, "recordID", recordID)
+	return nil
+}
+
+// findRecordID returns the ID of the ACME record with value at recordName, or
+// 0 if the API doesn't list it (yet).
+func findRecordID(ctx context.Context, client *contabo.Client, zone, recordName, value string) int64 {
+	records, err := client.ListRecords(ctx, zone, recordName)
+	if err != nil {
+		return 0
+	}
+	for _, record := range records {
+		if isACMERecord(record, recordName, value) {
+			return record.RecordID
+		}
+	}
+	return 0
+}
+
+// ledgerEntryFor returns the ledger entry for ch, or nil if there is none or
+// the ledger is disabled. Read errors are logged and treated as no entry, so
+// callers fall back to matching records by name and value.
+func (s *Solver) ledgerEntryFor(ctx context.Context, ch *v1alpha1.ChallengeRequest, zone string) *ledgerEntry {
+	if s.ledger == nil || ch.UID == "" {
+		return nil
+	}
+	entry, err := s.ledger.get(ctx, s.client, string(ch.UID))
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to read ledger entry")
+		return nil
+	}
+	if entry == nil || entry.Zone != zone || entry.Value != ch.Key {
+		return nil
+	}
+	return entry
+}
+
+func (s *Solver) newLedgerEntry(ctx context.Context, ch *v1alpha1.ChallengeRequest, zone, recordName string, existing *ledgerEntry) ledgerEntry {
+	now := time.Now().UTC()
+	entry := ledgerEntry{
+		ChallengeUID:            string(ch.UID),
+		ResourceNamespace:       ch.ResourceNamespace,
+		IssuerKind:              s.issuerKind(ch),
+		AllowAmbientCredentials: ch.AllowAmbientCredentials,
+		Zone:                    zone,
+		FQDN:                    ch.ResolvedFQDN,
+		RecordName:              recordName,
+		Value:                   ch.Key,
+		Config:                  json.RawMessage(ch.Config.Raw),
+		Profile:                 s.profileFrom(ctx).ledgerName(),
+		CreatedAt:               now,
+		UpdatedAt:               now,
+	}
+	if existing != nil {
+		entry.CreatedAt = existing.CreatedAt
+	}
+	return entry
+}
+
+// removeFromLedger drops the challenge's entry. Failures are only logged: a
+// stale entry is cleaned up by the garbage collector once the record is gone.
+func (s *Solver) removeFromLedger(ctx context.Context, ch *v1alpha1.ChallengeRequest) {
+	if s.ledger == nil || ch.UID == "" {
+		return
+	}
+	if err := s.ledger.remove(ctx, s.client, string(ch.UID)); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to remove challenge from ledger")
+	}
+}
+
+// challengeRequest rebuilds enough of the original ChallengeRequest to load
+// credentials and address the record.
+func (e *ledgerEntry) challengeRequest() *v1alpha1.ChallengeRequest {
+	return &v1alpha1.ChallengeRequest{
+		UID:                     types.UID(e.ChallengeUID),
+		Key:                     e.Value,
+		ResourceNamespace:       e.ResourceNamespace,
+		ResolvedFQDN:            e.FQDN,
+		ResolvedZone:            e.Zone,
+		AllowAmbientCredentials: e.AllowAmbientCredentials,
+		Config:                  &apiextensionsv1.JSON{Raw: e.Config},
+	}
+}
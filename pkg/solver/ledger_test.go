@@ -0,0 +1,91 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+	"cert-manager-webhook-contabo/pkg/metrics"
+)
+
+func TestLedgerRecordsPresentedRecord(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	WithLedger("webhook-ns")(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+
+	entry, err := s.ledger.get(context.Background(), s.client, "challenge-uid")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if entry == nil {
+		t.Fatalf("expected a ledger entry")
+	}
+	if entry.State != ledgerStatePresent || entry.RecordID != 1 || entry.RecordName != "_acme-challenge" ||
+		entry.IssuerKind != "Issuer" || entry.ResourceNamespace != "tenant-ns" || entry.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected ledger entry: %+v", entry)
+	}
+
+	// A record with the same name and key that this challenge didn't create
+	// must survive CleanUp.
+	f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "key"})
+
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if records := f.visible(); len(records) != 1 || records[0].RecordID != 2 {
+		t.Fatalf("expected only record 1 to be deleted, got %+v", records)
+	}
+	if entry, _ := s.ledger.get(context.Background(), s.client, "challenge-uid"); entry != nil {
+		t.Fatalf("expected ledger entry to be removed, got %+v", entry)
+	}
+}
+
+func TestLedgerKeepsPendingEntryWhenPresentFails(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	f.frozen = true
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.VerifyChanges = &ChangeVerification{TimeoutSecs: 1, IntervalSecs: 1}
+	})
+	WithLedger("webhook-ns")(s)
+
+	if err := s.Present(ch); !errors.Is(err, ErrNotConverged) {
+		t.Fatalf("expected ErrNotConverged, got %v", err)
+	}
+
+	entry, err := s.ledger.get(context.Background(), s.client, "challenge-uid")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if entry == nil || entry.State != ledgerStatePending || entry.RecordID != 0 {
+		t.Fatalf("expected a pending entry without record ID, got %+v", entry)
+	}
+}
+
+func TestLedgerManagedRecordsMetric(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	WithLedger("webhook-ns")(s)
+	managed := func() float64 {
+		return testutil.ToFloat64(metrics.ManagedRecords.WithLabelValues("example.com"))
+	}
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if got := managed(); got != 1 {
+		t.Fatalf("expected 1 managed record, got %v", got)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if got := managed(); got != 0 {
+		t.Fatalf("expected no managed records, got %v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package solver
+
+import (
+	"strings"
+	"sync"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// recordLocks serialises the list-then-write sequences of Present and CleanUp
+// per zone and record name. Wildcard and apex certificates produce two
+// challenges for the same _acme-challenge name, so the lock covers the name,
+// not the challenge. The zero value is ready to use.
+type recordLocks struct {
+	mu    sync.Mutex
+	locks map[string]*recordLock
+}
+
+type recordLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock acquires the lock for name in zone and returns the function releasing
+// it. Locks are dropped once nobody holds or waits for them.
+func (l *recordLocks) lock(zone, name string) func() {
+	key := strings.ToLower(zone) + "/" + strings.ToLower(name)
+
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*recordLock{}
+	}
+	lock := l.locks[key]
+	if lock == nil {
+		lock = &recordLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// coalesce runs fn once for concurrent identical requests, which cert-manager
+// sends when it retries a challenge that is still being presented. All callers
+// receive the result of the single run. action separates Present from CleanUp
+// as the request's Action field is not always set.
+func (s *Solver) coalesce(action v1alpha1.ChallengeAction, ch *v1alpha1.ChallengeRequest, fn func() error) error {
+	key := strings.Join([]string{string(action), string(ch.UID), ch.ResolvedZone, ch.ResolvedFQDN, ch.Key}, "|")
+	_, err, _ := s.inflight.Do(key, func() (any, error) {
+		return nil, fn()
+	})
+	return err
+}
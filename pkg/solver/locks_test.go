@@ -0,0 +1,57 @@
+package solver
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestConcurrentPresentCreatesNoDuplicates(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+
+	// Retries of the same challenge, a re-created challenge with the same key
+	// and the wildcard challenge for the same name, all at once.
+	var requests []*v1alpha1.ChallengeRequest
+	for i := 0; i < 30; i++ {
+		req := *ch
+		switch i % 3 {
+		case 1:
+			req.UID = types.UID(fmt.Sprintf("recreated-%d", i))
+		case 2:
+			req.UID = "wildcard-uid"
+			req.Key = "wildcard-key"
+		}
+		requests = append(requests, &req)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(requests))
+	for _, req := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.Present(req)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("present: %v", err)
+		}
+	}
+
+	if f.creates != 2 {
+		t.Fatalf("expected one create per key, got %d", f.creates)
+	}
+	if records := f.visible(); len(records) != 2 {
+		t.Fatalf("expected two records, got %+v", records)
+	}
+	if len(s.locks.locks) != 0 {
+		t.Fatalf("expected all record locks to be released, got %d", len(s.locks.locks))
+	}
+}
@@ -0,0 +1,47 @@
+package solver
+
+import (
+	"context"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+// loggerName is the name of the solver's loggers.
+const loggerName = "contabo"
+
+// challengeLogger returns a logger carrying the identity of ch, so that every
+// line logged while working on it, including those of the Contabo client, can
+// be tied to the Challenge and to the x-request-ids Contabo sees.
+func challengeLogger(ch *v1alpha1.ChallengeRequest) klog.Logger {
+	return klog.Background().WithName(loggerName).WithValues(
+		"challengeUID", ch.UID,
+		"resourceNamespace", ch.ResourceNamespace,
+		"fqdn", ch.ResolvedFQDN,
+		"zone", normalizeZone(ch.ResolvedZone),
+	)
+}
+
+// withChallengeLogger returns ctx with the challengeLogger of ch, which also
+// carries the trace ID when ctx holds a span, and the solver name for
+// challenges of a profile.
+func withChallengeLogger(ctx context.Context, ch *v1alpha1.ChallengeRequest) context.Context {
+	logger := challengeLogger(ch)
+	if p, ok := ctx.Value(profileKey{}).(*profile); ok && p.name != DefaultProfileName {
+		logger = logger.WithValues("solver", p.name)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		logger = logger.WithValues("traceID", spanContext.TraceID())
+	}
+	return klog.NewContext(ctx, logger)
+}
+
+// withRecordLogger returns ctx with a logger that additionally names the
+// record a delegated challenge is written to.
+func withRecordLogger(ctx context.Context, ch *v1alpha1.ChallengeRequest) context.Context {
+	return klog.NewContext(ctx, klog.FromContext(ctx).WithValues(
+		"recordFQDN", ch.ResolvedFQDN,
+		"recordZone", normalizeZone(ch.ResolvedZone),
+	))
+}
@@ -0,0 +1,48 @@
+package solver
+
+import (
+	"testing"
+
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+)
+
+// logValue returns the value logged for key in entry, or nil.
+func logValue(entry ktesting.LogEntry, key string) any {
+	kvs := append(append([]any{}, entry.WithKVList...), entry.ParameterKVList...)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if kvs[i] == key {
+			return kvs[i+1]
+		}
+	}
+	return nil
+}
+
+func TestLoggingCarriesChallenge(t *testing.T) {
+	logger := ktesting.NewLogger(t, ktesting.NewConfig(ktesting.Verbosity(4), ktesting.BufferLogs(true)))
+	klog.SetLoggerWithOptions(logger, klog.ContextualLogger(true))
+	t.Cleanup(klog.ClearLogger)
+
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+
+	buffer := logger.GetSink().(ktesting.Underlier).GetBuffer()
+	seen := map[string]bool{}
+	for _, entry := range buffer.Data() {
+		if logValue(entry, "challengeUID") != ch.UID || logValue(entry, "zone") != "example.com" {
+			continue
+		}
+		if entry.Message == "Contabo API request" && logValue(entry, "requestID") == nil {
+			t.Fatalf("expected the API request line to carry the request ID")
+		}
+		seen[entry.Message] = true
+	}
+	for _, message := range []string{"Creating TXT record", "Contabo API request", "Contabo token request"} {
+		if !seen[message] {
+			t.Fatalf("expected %q to be logged with the challenge, got:\n%s", message, buffer.String())
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package solver
+
+import (
+	"fmt"
+	"strings"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// DefaultClusterResourceNamespace matches cert-manager's default
+// --cluster-resource-namespace.
+const DefaultClusterResourceNamespace = "cert-manager"
+
+// NamespaceGrant allows Issuers in IssuerNamespace to reference credentials
+// Secrets in SecretNamespace. An IssuerNamespace of "*" matches any namespace.
+type NamespaceGrant struct {
+	IssuerNamespace string
+	SecretNamespace string
+}
+
+// ParseNamespaceGrants parses grants in the form ISSUER_NAMESPACE:SECRET_NAMESPACE.
+func ParseNamespaceGrants(values []string) ([]NamespaceGrant, error) {
+	grants := make([]NamespaceGrant, 0, len(values))
+	for _, value := range values {
+		issuerNS, secretNS, ok := strings.Cut(strings.TrimSpace(value), ":")
+		if !ok || issuerNS == "" || secretNS == "" || secretNS == "*" {
+			return nil, fmt.Errorf("invalid namespace grant %q: expected ISSUER_NAMESPACE:SECRET_NAMESPACE", value)
+		}
+		grants = append(grants, NamespaceGrant{IssuerNamespace: issuerNS, SecretNamespace: secretNS})
+	}
+	return grants, nil
+}
+
+// WithClusterResourceNamespace sets the namespace cert-manager reports as the
+// resource namespace for ClusterIssuers. Challenges from this namespace may
+// reference credentials Secrets in any namespace.
+func WithClusterResourceNamespace(namespace string) Option {
+	return func(s *Solver) {
+		s.clusterResourceNamespace = namespace
+	}
+}
+
+// WithNamespaceGrants allows the given cross-namespace credentials Secret
+// references for namespaced Issuers.
+func WithNamespaceGrants(grants ...NamespaceGrant) Option {
+	return func(s *Solver) {
+		s.namespaceGrants = append(s.namespaceGrants, grants...)
+	}
+}
+
+// checkSecretNamespace enforces that a namespaced Issuer only reads Secrets
+// from its own namespace unless a grant says otherwise.
+func (s *Solver) checkSecretNamespace(ch *v1alpha1.ChallengeRequest, secretNamespace, secretName string) error {
+	if s.namespaceAllowed(ch, secretNamespace) {
+		return nil
+	}
+
+	klog.InfoS("Denied cross-namespace credentials secret reference",
+		"audit", true,
+		"challengeUID", ch.UID,
+		"issuerNamespace", ch.ResourceNamespace,
+		"secretNamespace", secretNamespace,
+		"secretName", secretName,
+		"fqdn", ch.ResolvedFQDN,
+	)
+	return fmt.Errorf(
+		"credentials secret %s/%s is not readable from issuer namespace %q: cross-namespace references are only allowed for ClusterIssuers or namespaces granted via --allow-secret-namespace",
+		secretNamespace, secretName, ch.ResourceNamespace,
+	)
+}
+
+// namespaceAllowed reports whether the challenge may read credentials owned by
+// namespace.
+func (s *Solver) namespaceAllowed(ch *v1alpha1.ChallengeRequest, namespace string) bool {
+	if namespace == ch.ResourceNamespace || s.isClusterIssuer(ch) {
+		return true
+	}
+	for _, grant := range s.namespaceGrants {
+		if (grant.IssuerNamespace == "*" || grant.IssuerNamespace == ch.ResourceNamespace) && grant.SecretNamespace == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// isClusterIssuer reports whether the challenge comes from a ClusterIssuer,
+// going by the resource namespace cert-manager assigns to them.
+func (s *Solver) isClusterIssuer(ch *v1alpha1.ChallengeRequest) bool {
+	return s.clusterResourceNamespace != "" && ch.ResourceNamespace == s.clusterResourceNamespace
+}
+
+// issuerKind returns the kind of the challenge's issuer.
+func (s *Solver) issuerKind(ch *v1alpha1.ChallengeRequest) string {
+	if s.isClusterIssuer(ch) {
+		return "ClusterIssuer"
+	}
+	return "Issuer"
+}
@@ -0,0 +1,81 @@
+package solver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckSecretNamespace(t *testing.T) {
+	grants, err := ParseNamespaceGrants([]string{"team-a:shared", "*:common"})
+	if err != nil {
+		t.Fatalf("parse grants: %v", err)
+	}
+	s := NewSolver(WithNamespaceGrants(grants...))
+
+	tests := []struct {
+		name            string
+		issuerNamespace string
+		secretNamespace string
+		allowed         bool
+	}{
+		{"same namespace", "team-b", "team-b", true},
+		{"cross namespace denied", "team-b", "team-a", false},
+		{"cluster issuer", DefaultClusterResourceNamespace, "team-a", true},
+		{"explicit grant", "team-a", "shared", true},
+		{"grant for other issuer namespace", "team-b", "shared", false},
+		{"wildcard grant", "team-b", "common", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &v1alpha1.ChallengeRequest{ResourceNamespace: tt.issuerNamespace}
+			err := s.checkSecretNamespace(ch, tt.secretNamespace, "creds")
+			if tt.allowed && err != nil {
+				t.Fatalf("expected allowed, got %v", err)
+			}
+			if !tt.allowed && err == nil {
+				t.Fatalf("expected denial")
+			}
+		})
+	}
+}
+
+func TestLoadCredentialsDeniesCrossNamespace(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "team-a"},
+		Data: map[string][]byte{
+			secretKeyClientID:     []byte("id"),
+			secretKeyClientSecret: []byte("secret"),
+			secretKeyUsername:     []byte("user"),
+			secretKeyPassword:     []byte("pass"),
+		},
+	}
+
+	s := NewSolver()
+	s.client = kubefake.NewSimpleClientset(secret)
+
+	ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "team-b"}
+	cfg := &Config{CredentialsSecretName: "creds", CredentialsSecretNamespace: "team-a"}
+	_, err := s.loadCredentials(context.Background(), ch, cfg)
+	if err == nil || !strings.Contains(err.Error(), "team-a/creds") {
+		t.Fatalf("expected cross-namespace denial, got %v", err)
+	}
+
+	ch.ResourceNamespace = DefaultClusterResourceNamespace
+	if _, err := s.loadCredentials(context.Background(), ch, cfg); err != nil {
+		t.Fatalf("expected ClusterIssuer to read secret, got %v", err)
+	}
+}
+
+func TestParseNamespaceGrantsErrors(t *testing.T) {
+	for _, value := range []string{"", "team-a", ":shared", "team-a:", "team-a:*"} {
+		if _, err := ParseNamespaceGrants([]string{value}); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
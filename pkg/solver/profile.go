@@ -0,0 +1,217 @@
+package solver
+
+import (
+	"context"
+	encodingjson "encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook"
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/json"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultProfileName is the solverName of the solver configured by the
+// webhook's own flags and defaults file.
+const DefaultProfileName = "contabo"
+
+// EnvProfilesFile names the profiles file when --profiles-file is not given.
+const EnvProfilesFile = "CONTABO_WEBHOOK_PROFILES_FILE"
+
+// ProfilesFile lists named solvers served by the webhook next to the default
+// one. Issuers select a profile with solverName.
+type ProfilesFile struct {
+	// APIVersion is the version of the file and of the configs in it.
+	// Defaults to v1.
+	APIVersion string        `json:"apiVersion,omitempty"`
+	Profiles   []ProfileSpec `json:"profiles"`
+}
+
+// ProfileSpec is a named solver with its own defaults and overrides, which
+// take the place of the webhook's defaults file.
+type ProfileSpec struct {
+	Name string `json:"name"`
+	DefaultsFile
+}
+
+// Profile is a validated profile, ready to be served with WithProfiles.
+type Profile struct {
+	Name     string
+	Defaults *Defaults
+}
+
+// profile is a solverName served by a Solver and the defaults merged into the
+// configs of its Issuers.
+type profile struct {
+	name string
+	// defaultsPath is watched, calling loadDefaults when it changes.
+	defaultsPath string
+	loadDefaults func() (*Defaults, error)
+	defaults     atomic.Pointer[Defaults]
+}
+
+// WithProfiles serves every profile as a solver of its own, sharing the
+// Solver's options, ledger and locks. The profiles are reloaded from path
+// when it changes; adding or removing profiles needs a restart.
+func WithProfiles(path string, profiles ...Profile) Option {
+	return func(s *Solver) {
+		for _, spec := range profiles {
+			p := &profile{name: spec.Name, defaultsPath: path}
+			p.loadDefaults = func() (*Defaults, error) {
+				profiles, err := LoadProfilesFile(path)
+				if err != nil {
+					return nil, err
+				}
+				i := slices.IndexFunc(profiles, func(other Profile) bool { return other.Name == p.name })
+				if i < 0 {
+					return nil, fmt.Errorf("profile %s was removed from %s, restart the webhook to stop serving it", p.name, path)
+				}
+				return profiles[i].Defaults, nil
+			}
+			p.defaults.Store(spec.Defaults)
+			s.profiles = append(s.profiles, p)
+		}
+	}
+}
+
+// LoadProfilesFile reads and validates the profiles file at path.
+func LoadProfilesFile(path string) ([]Profile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %w", err)
+	}
+	profiles, err := parseProfiles(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profiles file %s: %w", path, err)
+	}
+	return profiles, nil
+}
+
+func parseProfiles(b []byte) ([]Profile, error) {
+	raw, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var file ProfilesFile
+	strictErrs, err := json.UnmarshalStrict(raw, &file)
+	if err != nil {
+		return nil, err
+	}
+	var errs field.ErrorList
+	for _, strictErr := range strictErrs {
+		errs = append(errs, strictError(nil, strictErr))
+	}
+	if file.APIVersion != "" && file.APIVersion != ConfigVersionV1 {
+		errs = append(errs, field.NotSupported(field.NewPath("apiVersion"), file.APIVersion, []string{ConfigVersionV1}))
+	}
+
+	names := map[string]bool{DefaultProfileName: true}
+	profiles := make([]Profile, 0, len(file.Profiles))
+	for i, spec := range file.Profiles {
+		fldPath := field.NewPath("profiles").Index(i)
+		// The name becomes an API resource of the webhook's group.
+		for _, msg := range validation.IsDNS1123Label(spec.Name) {
+			errs = append(errs, field.Invalid(fldPath.Child("name"), spec.Name, msg))
+		}
+		if names[spec.Name] {
+			errs = append(errs, field.Duplicate(fldPath.Child("name"), spec.Name))
+		}
+		names[spec.Name] = true
+		if spec.APIVersion != "" {
+			errs = append(errs, field.Forbidden(fldPath.Child("apiVersion"), "set the apiVersion of the file instead"))
+		}
+
+		defaults := &Defaults{}
+		defaults.defaults, errs = parseDefaultsLayer(fldPath.Child("defaults"), spec.Defaults, errs)
+		defaults.overrides, errs = parseDefaultsLayer(fldPath.Child("overrides"), spec.Overrides, errs)
+		defaults.raw, _ = encodingjson.Marshal(spec)
+		profiles = append(profiles, Profile{Name: spec.Name, Defaults: defaults})
+	}
+	if len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return profiles, nil
+}
+
+type profileKey struct{}
+
+// withProfile returns ctx for work on a challenge of p.
+func withProfile(ctx context.Context, p *profile) context.Context {
+	return context.WithValue(ctx, profileKey{}, p)
+}
+
+// profileFrom returns the profile of the challenge worked on in ctx, the
+// default profile unless ctx says otherwise.
+func (s *Solver) profileFrom(ctx context.Context) *profile {
+	if p, ok := ctx.Value(profileKey{}).(*profile); ok {
+		return p
+	}
+	return s.defaultProfile
+}
+
+// profileNamed returns the profile recorded as name in the ledger, where the
+// default profile is recorded as "". It returns nil for profiles that are no
+// longer served.
+func (s *Solver) profileNamed(name string) *profile {
+	if name == "" || name == s.defaultProfile.name {
+		return s.defaultProfile
+	}
+	for _, p := range s.profiles {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ledgerName returns the name recorded in the ledger for p.
+func (p *profile) ledgerName() string {
+	if p.name == DefaultProfileName {
+		return ""
+	}
+	return p.name
+}
+
+// Solvers returns the webhook.Solvers to serve: s itself, under
+// DefaultProfileName, followed by one per profile.
+func (s *Solver) Solvers() []webhook.Solver {
+	solvers := []webhook.Solver{s}
+	for _, p := range s.profiles {
+		solvers = append(solvers, &profileSolver{solver: s, profile: p})
+	}
+	return solvers
+}
+
+// profileSolver serves a profile of solver under the profile's name.
+type profileSolver struct {
+	solver  *Solver
+	profile *profile
+}
+
+func (ps *profileSolver) Name() string {
+	return ps.profile.name
+}
+
+// Initialize only starts watching the profile's defaults. Everything else is
+// shared with, and initialized by, the default solver.
+func (ps *profileSolver) Initialize(_ *rest.Config, stopCh <-chan struct{}) error {
+	if ps.profile.defaultsPath != "" {
+		go ps.profile.watchDefaults(stopCh)
+	}
+	return nil
+}
+
+func (ps *profileSolver) Present(ch *v1alpha1.ChallengeRequest) error {
+	return ps.solver.present(ps.profile, ch)
+}
+
+func (ps *profileSolver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
+	return ps.solver.cleanUp(ps.profile, ch)
+}
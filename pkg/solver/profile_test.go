@@ -0,0 +1,81 @@
+package solver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestInvalidProfilesRejected(t *testing.T) {
+	for _, tc := range []struct {
+		content string
+		want    string
+	}{
+		{"profiles:\n- name: Sandbox\n", `profiles[0].name: Invalid value: "Sandbox"`},
+		{"profiles:\n- name: contabo\n", `profiles[0].name: Duplicate value: "contabo"`},
+		{"profiles:\n- name: a\n- name: a\n", `profiles[1].name: Duplicate value: "a"`},
+		{"profiles:\n- name: a\n  defaults:\n    vault:\n      path: p\n", "profiles[0].defaults.vault: Forbidden"},
+		{"profiles:\n- name: a\n  apiVersion: v1\n", "profiles[0].apiVersion: Forbidden"},
+	} {
+		if _, err := parseProfiles([]byte(tc.content)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected error containing %q, got %v", tc.content, tc.want, err)
+		}
+	}
+}
+
+func TestProfileSolverUsesItsDefaults(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	profiles, err := parseProfiles([]byte("profiles:\n- name: contabo-long-ttl\n  overrides:\n    ttl: 3600\n"))
+	if err != nil {
+		t.Fatalf("parse profiles: %v", err)
+	}
+	WithProfiles("", profiles...)(s)
+	WithLedger("webhook-ns")(s)
+
+	solvers := s.Solvers()
+	if len(solvers) != 2 || solvers[0].Name() != DefaultProfileName || solvers[1].Name() != "contabo-long-ttl" {
+		t.Fatalf("unexpected solvers: %v", solvers)
+	}
+	if err := solvers[1].Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if records := f.visible(); len(records) != 1 || records[0].TTL != 3600 {
+		t.Fatalf("expected a record with the profile's TTL, got %+v", records)
+	}
+
+	entry, err := s.ledger.get(context.Background(), s.client, "challenge-uid")
+	if err != nil || entry == nil || entry.Profile != "contabo-long-ttl" {
+		t.Fatalf("expected the profile in the ledger entry, got %+v, %v", entry, err)
+	}
+	if err := solvers[1].CleanUp(ch); err != nil {
+		t.Fatalf("clean up: %v", err)
+	}
+	if records := f.visible(); len(records) != 0 {
+		t.Fatalf("expected the record to be deleted, got %+v", records)
+	}
+}
+
+func TestReconcilerResolvesProfiles(t *testing.T) {
+	profiles, err := parseProfiles([]byte("profiles:\n- name: sandbox\n"))
+	if err != nil {
+		t.Fatalf("parse profiles: %v", err)
+	}
+	s := NewSolver(WithProfiles("", profiles...), WithStartupReconciler("acme.contabo.com"))
+
+	for solverName, want := range map[string]string{
+		"contabo": DefaultProfileName,
+		"sandbox": "sandbox",
+		"other":   "",
+	} {
+		obj := &unstructured.Unstructured{Object: map[string]any{}}
+		_ = unstructured.SetNestedField(obj.Object, "acme.contabo.com", "spec", "solver", "dns01", "webhook", "groupName")
+		_ = unstructured.SetNestedField(obj.Object, solverName, "spec", "solver", "dns01", "webhook", "solverName")
+		p := s.profileFor(obj)
+		if (p == nil && want != "") || (p != nil && p.name != want) {
+			t.Errorf("%s: expected profile %q, got %+v", solverName, want, p)
+		}
+	}
+}
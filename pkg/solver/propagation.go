@@ -0,0 +1,155 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Present runs inside the apiserver's request to the webhook, which the
+	// apiserver gives up on after 60 seconds, so all of it, API calls and
+	// DNS waits alike, runs under one deadline well below that. A record
+	// that hasn't propagated by then fails Present with a transient error,
+	// and cert-manager's retry finds the record in place and checks again.
+	// The propagation wait is capped on its own so that it can't use up the
+	// deadline of the steps before it.
+	defaultPresentDeadline     = 50 * time.Second
+	defaultPropagationTimeout  = 20 * time.Second
+	maxPropagationTimeoutSecs  = 30
+	defaultPropagationInterval = 2 * time.Second
+)
+
+// waitForPropagation polls the zone's authoritative nameservers until each of
+// them serves a TXT record with value at fqdn. It returns nil immediately when
+// check is nil.
+func waitForPropagation(ctx context.Context, check *PropagationCheck, zone, fqdn, value string) error {
+	if check == nil {
+		return nil
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, check.timeout())
+	defer cancel()
+
+	nameservers, err := authoritativeNameservers(ctx, check, zone)
+	if err != nil {
+		return err
+	}
+
+	fqdn = dnsName(fqdn)
+	lagging := make(map[string]string, len(nameservers))
+	for _, ns := range nameservers {
+		lagging[ns] = "not queried yet"
+	}
+
+	ticker := time.NewTicker(check.interval())
+	defer ticker.Stop()
+
+	for {
+		for ns := range lagging {
+			found, err := nameserverHasTXT(ctx, ns, fqdn, value)
+			switch {
+			case err != nil:
+				lagging[ns] = err.Error()
+			case !found:
+				lagging[ns] = "record not served yet"
+			default:
+				delete(lagging, ns)
+			}
+		}
+		if len(lagging) == 0 {
+			klog.FromContext(ctx).Info("TXT record is served by all authoritative nameservers", "recordFQDN", fqdn, "nameservers", nameservers)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			// The deadline of Present may have come before check's.
+			return fmt.Errorf("TXT record %s did not propagate within %s: lagging nameservers: %s", fqdn, time.Since(start).Round(time.Second), describeLagging(lagging))
+		case <-ticker.C:
+		}
+	}
+}
+
+// authoritativeNameservers returns host:port addresses of the zone's
+// nameservers, either from the config or the zone's NS records.
+func authoritativeNameservers(ctx context.Context, check *PropagationCheck, zone string) ([]string, error) {
+	hosts := check.Nameservers
+	if len(hosts) == 0 {
+		records, err := net.DefaultResolver.LookupNS(ctx, dnsName(zone))
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up nameservers of zone %s: %w", zone, err)
+		}
+		for _, record := range records {
+			hosts = append(hosts, record.Host)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("zone %s has no nameservers", zone)
+	}
+
+	addrs := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.TrimSuffix(host, "."), "53")
+		}
+		addrs = append(addrs, host)
+	}
+	return addrs, nil
+}
+
+// nameserverHasTXT queries ns directly, bypassing any recursive resolver and
+// its negative cache.
+func nameserverHasTXT(ctx context.Context, ns, fqdn, value string) (bool, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, ns)
+		},
+	}
+
+	records, err := resolver.LookupTXT(ctx, fqdn)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return slices.Contains(records, value), nil
+}
+
+func describeLagging(lagging map[string]string) string {
+	parts := make([]string, 0, len(lagging))
+	for ns, reason := range lagging {
+		parts = append(parts, fmt.Sprintf("%s (%s)", ns, reason))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// dnsName returns name as a fully qualified domain name with a trailing dot.
+func dnsName(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+func (c *PropagationCheck) timeout() time.Duration {
+	if c.TimeoutSecs <= 0 {
+		return defaultPropagationTimeout
+	}
+	return time.Duration(c.TimeoutSecs) * time.Second
+}
+
+func (c *PropagationCheck) interval() time.Duration {
+	if c.IntervalSecs <= 0 {
+		return defaultPropagationInterval
+	}
+	return time.Duration(c.IntervalSecs) * time.Second
+}
@@ -0,0 +1,175 @@
+package solver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testNameserver is a minimal authoritative DNS server answering TXT and
+// CNAME queries over UDP from an in-memory record set.
+type testNameserver struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	records map[string][]string
+	cnames  map[string]string
+}
+
+func newTestNameserver(t *testing.T) *testNameserver {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ns := &testNameserver{conn: conn, records: map[string][]string{}, cnames: map[string]string{}}
+	t.Cleanup(func() { _ = conn.Close() })
+	go ns.serve()
+	return ns
+}
+
+func (ns *testNameserver) addr() string {
+	return ns.conn.LocalAddr().String()
+}
+
+func (ns *testNameserver) setTXT(name string, values ...string) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.records[strings.ToLower(name)] = values
+}
+
+func (ns *testNameserver) setCNAME(name, target string) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.cnames[strings.ToLower(name)] = target
+}
+
+func (ns *testNameserver) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := ns.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+			continue
+		}
+		resp, err := ns.answer(msg)
+		if err != nil {
+			continue
+		}
+		_, _ = ns.conn.WriteTo(resp, addr)
+	}
+}
+
+func (ns *testNameserver) answer(query dnsmessage.Message) ([]byte, error) {
+	q := query.Questions[0]
+	ns.mu.Lock()
+	values, ok := ns.records[strings.ToLower(q.Name.String())]
+	cname, isCNAME := ns.cnames[strings.ToLower(q.Name.String())]
+	ns.mu.Unlock()
+
+	header := dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true}
+	if !ok && !isCNAME {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, header)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if isCNAME {
+		target, err := dnsmessage.NewName(cname)
+		if err != nil {
+			return nil, err
+		}
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 60}
+		if err := b.CNAMEResource(rh, dnsmessage.CNAMEResource{CNAME: target}); err != nil {
+			return nil, err
+		}
+	}
+	if q.Type == dnsmessage.TypeTXT {
+		for _, value := range values {
+			rh := dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 60}
+			if err := b.TXTResource(rh, dnsmessage.TXTResource{TXT: []string{value}}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+func TestWaitForPropagation(t *testing.T) {
+	ns1 := newTestNameserver(t)
+	ns2 := newTestNameserver(t)
+	ns1.setTXT("_acme-challenge.example.com.", "old", "key")
+	ns2.setTXT("_acme-challenge.example.com.", "old", "key")
+
+	check := &PropagationCheck{
+		TimeoutSecs:  2,
+		IntervalSecs: 1,
+		Nameservers:  []string{ns1.addr(), ns2.addr()},
+	}
+	if err := waitForPropagation(context.Background(), check, "example.com", "_acme-challenge.example.com.", "key"); err != nil {
+		t.Fatalf("wait for propagation: %v", err)
+	}
+}
+
+func TestWaitForPropagationReportsLaggingNameservers(t *testing.T) {
+	ns1 := newTestNameserver(t)
+	ns2 := newTestNameserver(t)
+	ns1.setTXT("_acme-challenge.example.com.", "key")
+	ns2.setTXT("_acme-challenge.example.com.", "old")
+
+	check := &PropagationCheck{
+		TimeoutSecs:  1,
+		IntervalSecs: 1,
+		Nameservers:  []string{ns1.addr(), ns2.addr()},
+	}
+	err := waitForPropagation(context.Background(), check, "example.com", "_acme-challenge.example.com", "key")
+	if err == nil {
+		t.Fatalf("expected propagation timeout")
+	}
+	if !strings.Contains(err.Error(), ns2.addr()) || strings.Contains(err.Error(), ns1.addr()) {
+		t.Fatalf("expected only %s to be reported as lagging, got %v", ns2.addr(), err)
+	}
+}
+
+func TestPresentDeadlineBoundsPropagation(t *testing.T) {
+	ns := newTestNameserver(t)
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.PropagationCheck = &PropagationCheck{TimeoutSecs: maxPropagationTimeoutSecs, IntervalSecs: 1, Nameservers: []string{ns.addr()}}
+	})
+	s.presentDeadline = time.Second
+
+	start := time.Now()
+	err := s.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "did not propagate within 1s") {
+		t.Fatalf("expected the present deadline to end the propagation wait, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected Present to return by its deadline, took %s", elapsed)
+	}
+}
+
+func TestAuthoritativeNameserversDefaultPort(t *testing.T) {
+	addrs, err := authoritativeNameservers(t.Context(), &PropagationCheck{Nameservers: []string{"ns1.contabo.net.", "127.0.0.1:5353"}}, "example.com")
+	if err != nil {
+		t.Fatalf("nameservers: %v", err)
+	}
+	if addrs[0] != "ns1.contabo.net:53" || addrs[1] != "127.0.0.1:5353" {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+}
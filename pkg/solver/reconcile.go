@@ -0,0 +1,193 @@
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const reconcileTimeout = 5 * time.Minute
+
+// finishedChallengeStates are the Challenge states after which cert-manager
+// no longer needs the TXT record.
+var finishedChallengeStates = map[string]bool{
+	"valid":   true,
+	"invalid": true,
+	"expired": true,
+	"errored": true,
+}
+
+// WithStartupReconciler reconciles the Challenges handled by this solver once
+// after the webhook starts: TXT records of in-flight Challenges are presented
+// again and leftovers of finished ones are cleaned up. groupName is the
+// webhook's API group, which Challenges reference in
+// spec.solver.dns01.webhook.groupName.
+func WithStartupReconciler(groupName string) Option {
+	return func(s *Solver) {
+		s.reconcileGroupName = groupName
+	}
+}
+
+func (s *Solver) runStartupReconciler(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithTimeout(wait.ContextForChannel(stopCh), reconcileTimeout)
+	defer cancel()
+	if err := s.reconcileChallenges(ctx); err != nil {
+		klog.Errorf("startup reconciliation failed: %v", err)
+	}
+}
+
+// reconcileChallenges runs a single reconciliation over all Challenges.
+func (s *Solver) reconcileChallenges(ctx context.Context) error {
+	if s.dynamic == nil {
+		return fmt.Errorf("dynamic client is not initialized")
+	}
+	list, err := s.dynamic.Resource(ChallengeGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list challenges: %w", err)
+	}
+
+	var errs []error
+	var presented, cleaned int
+	for i := range list.Items {
+		obj := &list.Items[i]
+		p := s.profileFor(obj)
+		if p == nil {
+			continue
+		}
+
+		state, _, _ := unstructured.NestedString(obj.Object, "status", "state")
+		processing, _, _ := unstructured.NestedBool(obj.Object, "status", "processing")
+		finished := finishedChallengeStates[state] || obj.GetDeletionTimestamp() != nil
+		if !finished && !processing {
+			continue
+		}
+
+		ch, err := s.challengeRequestFor(ctx, obj)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("challenge %s/%s: %w", obj.GetNamespace(), obj.GetName(), err))
+			continue
+		}
+
+		if finished {
+			ch.Action = v1alpha1.ChallengeActionCleanUp
+			err = s.cleanUp(p, ch)
+			cleaned++
+		} else {
+			ch.Action = v1alpha1.ChallengeActionPresent
+			err = s.present(p, ch)
+			presented++
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("challenge %s/%s: %s: %w", obj.GetNamespace(), obj.GetName(), ch.Action, err))
+		}
+	}
+
+	klog.Infof("startup reconciliation finished: %d presented, %d cleaned up, %d failed", presented, cleaned, len(errs))
+	return errors.Join(errs...)
+}
+
+// profileFor returns the profile obj is a DNS01 Challenge for, or nil if it
+// is not one of this webhook's.
+func (s *Solver) profileFor(obj *unstructured.Unstructured) *profile {
+	groupName, _, _ := unstructured.NestedString(obj.Object, "spec", "solver", "dns01", "webhook", "groupName")
+	solverName, _, _ := unstructured.NestedString(obj.Object, "spec", "solver", "dns01", "webhook", "solverName")
+	if groupName != s.reconcileGroupName || solverName == "" {
+		return nil
+	}
+	return s.profileNamed(solverName)
+}
+
+// challengeRequestFor builds the ChallengeRequest cert-manager would send for
+// obj. The zone and whether ambient credentials are allowed are taken from the
+// ledger when the record is known there. Otherwise the zone is looked up in
+// DNS and ambient credentials are not allowed, since cert-manager only allows
+// them when started with --cluster-issuer-ambient-credentials.
+func (s *Solver) challengeRequestFor(ctx context.Context, obj *unstructured.Unstructured) (*v1alpha1.ChallengeRequest, error) {
+	domain, _, _ := unstructured.NestedString(obj.Object, "spec", "dnsName")
+	key, _, _ := unstructured.NestedString(obj.Object, "spec", "key")
+	issuerKind, _, _ := unstructured.NestedString(obj.Object, "spec", "issuerRef", "kind")
+	cnameStrategy, _, _ := unstructured.NestedString(obj.Object, "spec", "solver", "dns01", "cnameStrategy")
+	config, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "solver", "dns01", "webhook", "config")
+	if domain == "" || key == "" {
+		return nil, fmt.Errorf("spec.dnsName and spec.key are required")
+	}
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode solver config: %w", err)
+	}
+
+	ch := &v1alpha1.ChallengeRequest{
+		UID:               obj.GetUID(),
+		Type:              "dns-01",
+		DNSName:           domain,
+		Key:               key,
+		ResourceNamespace: obj.GetNamespace(),
+		ResolvedFQDN:      dnsName("_acme-challenge." + strings.TrimPrefix(domain, "*.")),
+		Config:            &apiextensionsv1.JSON{Raw: raw},
+	}
+	if issuerKind == "ClusterIssuer" {
+		ch.ResourceNamespace = s.clusterResourceNamespace
+	}
+	if cnameStrategy == "Follow" {
+		if ch.ResolvedFQDN, err = s.followCNAME(ctx, ch.ResolvedFQDN); err != nil {
+			return nil, err
+		}
+	}
+
+	var zone string
+	if s.ledger != nil {
+		entry, err := s.ledger.get(ctx, s.client, string(ch.UID))
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			zone = entry.Zone
+			ch.AllowAmbientCredentials = entry.AllowAmbientCredentials
+		}
+	}
+	if zone == "" {
+		if zone, err = s.findZone(ctx, ch.ResolvedFQDN); err != nil {
+			return nil, err
+		}
+	}
+	ch.ResolvedZone = dnsName(zone)
+	return ch, nil
+}
+
+// followCNAMEByDNS returns the name the CNAMEs at fqdn lead to, or fqdn
+// itself when it has none, like cert-manager does for cnameStrategy Follow.
+func followCNAMEByDNS(ctx context.Context, fqdn string) (string, error) {
+	target, err := net.DefaultResolver.LookupCNAME(ctx, fqdn)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return fqdn, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to follow CNAMEs of %s: %w", fqdn, err)
+	}
+	return dnsName(target), nil
+}
+
+// findZoneByNS returns the closest enclosing domain of fqdn that has NS
+// records, which is how cert-manager resolves the zone of a challenge.
+func findZoneByNS(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if records, err := net.DefaultResolver.LookupNS(ctx, candidate+"."); err == nil && len(records) > 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find the zone of %s", fqdn)
+}
@@ -0,0 +1,111 @@
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+func newSolverChallenge(t *testing.T, name, uid, key, solverName, state string, processing bool, config []byte) *unstructured.Unstructured {
+	t.Helper()
+	var cfg map[string]any
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+	obj := newChallengeObject("tenant-ns", name, uid)
+	obj.Object["spec"] = map[string]any{
+		"dnsName":   "example.com",
+		"key":       key,
+		"issuerRef": map[string]any{"name": "letsencrypt", "kind": "Issuer"},
+		"solver": map[string]any{
+			"dns01": map[string]any{
+				"webhook": map[string]any{
+					"groupName":  "acme.contabo.com",
+					"solverName": solverName,
+					"config":     cfg,
+				},
+			},
+		},
+	}
+	obj.Object["status"] = map[string]any{"state": state, "processing": processing}
+	return obj
+}
+
+func TestReconcileChallenges(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "finished-key"})
+	f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "other-solver-key"})
+
+	s, ch := newTestSolver(t, f, nil)
+	WithStartupReconciler("acme.contabo.com")(s)
+	s.findZone = func(_ context.Context, fqdn string) (string, error) {
+		if fqdn != "_acme-challenge.example.com." {
+			t.Errorf("unexpected fqdn %q", fqdn)
+		}
+		return "example.com", nil
+	}
+	s.dynamic = newFakeDynamic(
+		newSolverChallenge(t, "in-flight", "uid-1", "pending-key", "contabo", "pending", true, ch.Config.Raw),
+		newSolverChallenge(t, "not-started", "uid-2", "queued-key", "contabo", "", false, ch.Config.Raw),
+		newSolverChallenge(t, "finished", "uid-3", "finished-key", "contabo", "valid", false, ch.Config.Raw),
+		newSolverChallenge(t, "other", "uid-4", "other-solver-key", "route53", "valid", false, ch.Config.Raw),
+	)
+
+	if err := s.reconcileChallenges(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	values := map[string]bool{}
+	for _, record := range f.visible() {
+		values[record.Data] = true
+	}
+	if len(values) != 2 || !values["pending-key"] || !values["other-solver-key"] {
+		t.Fatalf("expected the in-flight record to be presented and the finished one removed, got %v", values)
+	}
+}
+
+func TestChallengeRequestForClusterIssuer(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	WithLedger("webhook-ns")(s)
+	s.findZone = func(context.Context, string) (string, error) { return "example.org", nil }
+	s.followCNAME = func(_ context.Context, fqdn string) (string, error) {
+		if fqdn != "_acme-challenge.example.com." {
+			t.Errorf("unexpected fqdn %q", fqdn)
+		}
+		return "_acme-challenge.validation.example.org.", nil
+	}
+
+	obj := newSolverChallenge(t, "challenge", "uid-1", "key", "contabo", "pending", true, ch.Config.Raw)
+	_ = unstructured.SetNestedField(obj.Object, "ClusterIssuer", "spec", "issuerRef", "kind")
+	_ = unstructured.SetNestedField(obj.Object, "Follow", "spec", "solver", "dns01", "cnameStrategy")
+
+	// cert-manager decides about ambient credentials; without a ledger entry
+	// recording its decision, they are not allowed.
+	req, err := s.challengeRequestFor(context.Background(), obj)
+	if err != nil {
+		t.Fatalf("challenge request: %v", err)
+	}
+	if req.AllowAmbientCredentials || req.ResourceNamespace != DefaultClusterResourceNamespace {
+		t.Fatalf("expected ambient credentials to be denied, got %+v", req)
+	}
+	if req.ResolvedFQDN != "_acme-challenge.validation.example.org." || req.ResolvedZone != "example.org." {
+		t.Fatalf("expected the CNAME to be followed, got %s in %s", req.ResolvedFQDN, req.ResolvedZone)
+	}
+
+	req.AllowAmbientCredentials = true
+	entry := s.newLedgerEntry(context.Background(), req, "example.org", "_acme-challenge.validation", nil)
+	if err := s.ledger.put(context.Background(), s.client, entry); err != nil {
+		t.Fatalf("put ledger entry: %v", err)
+	}
+	if req, err = s.challengeRequestFor(context.Background(), obj); err != nil {
+		t.Fatalf("challenge request: %v", err)
+	}
+	if !req.AllowAmbientCredentials {
+		t.Fatalf("expected the ledger's ambient credentials flag to be used")
+	}
+}
@@ -0,0 +1,195 @@
+package solver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// cleanupScheduler holds the deletions deferred by cleanupDelay, keyed by
+// zone, FQDN and value so that a later Present of the same record can cancel
+// them. The ledger makes them survive restarts. The zero value is ready to
+// use.
+type cleanupScheduler struct {
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+}
+
+func cleanupKey(zone, fqdn, value string) string {
+	return normalizeName(zone) + "|" + normalizeName(fqdn) + "|" + value
+}
+
+// schedule runs fn at the given time, replacing any deletion already
+// scheduled under key.
+func (c *cleanupScheduler) schedule(key string, at time.Time, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = map[string]*time.Timer{}
+	}
+	if timer := c.pending[key]; timer != nil {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(at), func() {
+		c.mu.Lock()
+		current := c.pending[key] == timer
+		if current {
+			delete(c.pending, key)
+		}
+		c.mu.Unlock()
+		if current {
+			fn()
+		}
+	})
+	c.pending[key] = timer
+}
+
+// cancel drops the deletion scheduled under key and reports whether there was
+// one.
+func (c *cleanupScheduler) cancel(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := c.pending[key]
+	if timer == nil {
+		return false
+	}
+	timer.Stop()
+	delete(c.pending, key)
+	return true
+}
+
+// scheduleCleanUp defers the deletion of the challenge's record until at,
+// recording it in the ledger first so a restart doesn't lose it.
+func (s *Solver) scheduleCleanUp(ctx context.Context, ch *v1alpha1.ChallengeRequest, at time.Time) error {
+	logger := klog.FromContext(ctx)
+	zone := normalizeZone(ch.ResolvedZone)
+	if s.ledger != nil && ch.UID != "" {
+		ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+		existing, err := s.ledger.get(ctx, s.client, string(ch.UID))
+		if err != nil {
+			return err
+		}
+		entry := s.newLedgerEntry(ctx, ch, zone, relativeRecordName(ch.ResolvedFQDN, ch.ResolvedZone), existing)
+		if existing != nil {
+			entry.RecordID = existing.RecordID
+		}
+		entry.State = ledgerStateCleanupScheduled
+		deleteAfter := at.UTC()
+		entry.DeleteAfter = &deleteAfter
+		if err := s.ledger.put(ctx, s.client, entry); err != nil {
+			return err
+		}
+	} else {
+		logger.Info("Challenge has no UID to record in the ledger, the deferred deletion of the TXT record is lost if the webhook restarts")
+	}
+
+	logger.Info("Deferring deletion of TXT record", "deleteAfter", at.Format(time.RFC3339))
+	p := s.profileFrom(ctx)
+	s.cleanups.schedule(cleanupKey(zone, ch.ResolvedFQDN, ch.Key), at, func() {
+		s.runScheduledCleanUp(p, ch)
+	})
+	return nil
+}
+
+// runScheduledCleanUp deletes the challenge's record once its deferred
+// deletion is due. Every replica arms a timer for the entries it finds in the
+// ledger, and another replica may have presented the record again since, so
+// cleanUpRecord reads the ledger entry again under the record lock and the
+// zone's Lease, and the entry has the final say.
+func (s *Solver) runScheduledCleanUp(p *profile, ch *v1alpha1.ChallengeRequest) {
+	ctx, span := s.startSpan(withProfile(context.Background(), p), "ScheduledCleanUp", ch)
+	ctx = withChallengeLogger(ctx, ch)
+	err := s.coalesce(v1alpha1.ChallengeActionCleanUp, ch, func() error {
+		return s.cleanUpRecord(ctx, ch, true)
+	})
+	endSpan(span, err)
+	if err != nil {
+		// The ledger entry stays, so the garbage collector retries.
+		klog.FromContext(ctx).Error(err, "Deferred deletion of TXT record failed", "class", ClassOf(err))
+	}
+}
+
+// scheduledCleanUpDue reports whether the ledger still schedules the
+// deletion of the challenge's record, and it is due.
+func (s *Solver) scheduledCleanUpDue(ctx context.Context, ch *v1alpha1.ChallengeRequest) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	entry, err := s.ledger.get(ctx, s.client, string(ch.UID))
+	if err != nil {
+		return false, err
+	}
+	return entry != nil && entry.State == ledgerStateCleanupScheduled && entry.DeleteAfter != nil &&
+		entry.deletionDue(time.Now()), nil
+}
+
+// cancelScheduledCleanUp keeps a record that is presented again before its
+// deferred deletion ran. Ledger entries of other challenges scheduled to
+// delete the same record are dropped; the record now belongs to ch.
+func (s *Solver) cancelScheduledCleanUp(ctx context.Context, ch *v1alpha1.ChallengeRequest) {
+	logger := klog.FromContext(ctx)
+	zone := normalizeZone(ch.ResolvedZone)
+	key := cleanupKey(zone, ch.ResolvedFQDN, ch.Key)
+	if s.cleanups.cancel(key) {
+		logger.Info("TXT record presented again, cancelled its deferred deletion")
+	}
+	if s.ledger == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	entries, err := s.ledger.list(ctx, s.client)
+	if err != nil {
+		logger.Error(err, "Failed to read ledger")
+		return
+	}
+	for _, entry := range entries {
+		if entry.State != ledgerStateCleanupScheduled || entry.ChallengeUID == string(ch.UID) ||
+			cleanupKey(entry.Zone, entry.FQDN, entry.Value) != key {
+			continue
+		}
+		if err := s.ledger.remove(ctx, s.client, entry.ChallengeUID); err != nil {
+			logger.Error(err, "Failed to remove challenge from ledger", "ownerUID", entry.ChallengeUID)
+		}
+	}
+}
+
+// resumeScheduledCleanUps reschedules the deferred deletions in the ledger
+// after a restart. Overdue ones run immediately.
+func (s *Solver) resumeScheduledCleanUps() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	entries, err := s.ledger.list(ctx, s.client)
+	if err != nil {
+		klog.Errorf("failed to resume deferred deletions: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.State != ledgerStateCleanupScheduled || entry.DeleteAfter == nil {
+			continue
+		}
+		ch := entry.challengeRequest()
+		p := s.profileNamed(entry.Profile)
+		if p == nil {
+			// The garbage collector reports the record once it is due.
+			challengeLogger(ch).Info("Not resuming deferred deletion of TXT record, its solver is no longer served", "solver", entry.Profile)
+			continue
+		}
+		challengeLogger(ch).Info("Resuming deferred deletion of TXT record", "deleteAfter", entry.DeleteAfter.Format(time.RFC3339))
+		s.cleanups.schedule(cleanupKey(entry.Zone, entry.FQDN, entry.Value), *entry.DeleteAfter, func() {
+			s.runScheduledCleanUp(p, ch)
+		})
+	}
+}
+
+// deletionDue reports whether a deferred deletion in entry is due, or there
+// is none.
+func (e *ledgerEntry) deletionDue(now time.Time) bool {
+	return e.DeleteAfter == nil || !now.Before(*e.DeleteAfter)
+}
@@ -0,0 +1,215 @@
+package solver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// waitFor polls cond for up to two seconds.
+func waitFor(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCleanupDelayDefersDeletion(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.CleanupDelay = &metav1.Duration{Duration: 200 * time.Millisecond}
+	})
+	WithLedger("webhook-ns")(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if len(f.visible()) != 1 {
+		t.Fatalf("expected the record to be kept until the delay passed")
+	}
+	entry, err := s.ledger.get(context.Background(), s.client, "challenge-uid")
+	if err != nil || entry == nil || entry.State != ledgerStateCleanupScheduled || entry.DeleteAfter == nil {
+		t.Fatalf("expected a scheduled deletion in the ledger, got %+v, %v", entry, err)
+	}
+
+	if !waitFor(t, func() bool { return len(f.visible()) == 0 }) {
+		t.Fatalf("expected the record to be deleted after the delay")
+	}
+	if !waitFor(t, func() bool {
+		entry, _ := s.ledger.get(context.Background(), s.client, "challenge-uid")
+		return entry == nil
+	}) {
+		t.Fatalf("expected the ledger entry to be removed")
+	}
+}
+
+func TestCleanupDelayRequiresLedger(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.CleanupDelay = &metav1.Duration{Duration: time.Minute}
+	})
+
+	err := s.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "config.cleanupDelay: Forbidden") || ClassOf(err) != ErrorClassConfiguration {
+		t.Fatalf("expected cleanupDelay to be rejected without the ledger, got %v", err)
+	}
+	if f.creates != 0 {
+		t.Fatalf("expected no record to be created, got %d creates", f.creates)
+	}
+}
+
+func TestPresentCancelsDeferredDeletion(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.CleanupDelay = &metav1.Duration{Duration: time.Hour}
+	})
+	WithLedger("webhook-ns")(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	retry := *ch
+	retry.UID = "retry-uid"
+	if err := s.Present(&retry); err != nil {
+		t.Fatalf("present again: %v", err)
+	}
+
+	if len(s.cleanups.pending) != 0 {
+		t.Fatalf("expected the deferred deletion to be cancelled")
+	}
+	if f.creates != 1 || len(f.visible()) != 1 {
+		t.Fatalf("expected the existing record to be reused, got %d creates", f.creates)
+	}
+	entries, err := s.ledger.list(context.Background(), s.client)
+	if err != nil {
+		t.Fatalf("list ledger: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ChallengeUID != "retry-uid" || entries[0].State != ledgerStatePresent {
+		t.Fatalf("expected the record to belong to the new challenge, got %+v", entries)
+	}
+}
+
+func TestDeferredDeletionYieldsToPresentOnAnotherReplica(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	a, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.CleanupDelay = &metav1.Duration{Duration: 200 * time.Millisecond}
+	})
+	WithLedger("webhook-ns")(a)
+	b := NewSolver(WithLedger("webhook-ns"))
+	b.client = a.client
+
+	if err := a.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := a.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	// Replica b finds the deferred deletion in the ledger on startup, then
+	// presents the record again for a retried challenge.
+	b.resumeScheduledCleanUps()
+	retry := *ch
+	retry.UID = "retry-uid"
+	if err := b.Present(&retry); err != nil {
+		t.Fatalf("present on replica b: %v", err)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if f.deletes != 0 || len(f.visible()) != 1 {
+		t.Fatalf("expected the record presented again to be kept, got %d deletes", f.deletes)
+	}
+	entry, err := b.ledger.get(context.Background(), b.client, "retry-uid")
+	if err != nil || entry == nil || entry.State != ledgerStatePresent {
+		t.Fatalf("expected the record to belong to the retried challenge, got %+v, %v", entry, err)
+	}
+}
+
+func TestResumeScheduledCleanUps(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.CleanupDelay = &metav1.Duration{Duration: time.Hour}
+	})
+	WithLedger("webhook-ns")(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	// A webhook restarted after the delay passed only has the ledger.
+	s.cleanups.cancel(cleanupKey("example.com", ch.ResolvedFQDN, ch.Key))
+	entry, err := s.ledger.get(context.Background(), s.client, "challenge-uid")
+	if err != nil || entry == nil {
+		t.Fatalf("expected a ledger entry, got %v", err)
+	}
+	overdue := time.Now().Add(-time.Minute)
+	entry.DeleteAfter = &overdue
+	if err := s.ledger.put(context.Background(), s.client, *entry); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	s.resumeScheduledCleanUps()
+
+	if !waitFor(t, func() bool { return len(f.visible()) == 0 }) {
+		t.Fatalf("expected the overdue deletion to run after resuming")
+	}
+}
+
+func TestDeferredDeletionRechecksLedgerUnderLock(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.CleanupDelay = &metav1.Duration{Duration: time.Hour}
+	})
+	WithLedger("webhook-ns")(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	s.cleanups.cancel(cleanupKey("example.com", ch.ResolvedFQDN, ch.Key))
+	entry, err := s.ledger.get(context.Background(), s.client, "challenge-uid")
+	if err != nil || entry == nil {
+		t.Fatalf("expected a ledger entry, got %v", err)
+	}
+	overdue := time.Now().Add(-time.Minute)
+	entry.DeleteAfter = &overdue
+	if err := s.ledger.put(context.Background(), s.client, *entry); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	// The deletion is due when it starts, but another replica presents the
+	// record again while it waits for the record lock.
+	unlock := s.locks.lock("example.com", "_acme-challenge")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.runScheduledCleanUp(s.defaultProfile, ch)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	entry.State = ledgerStatePresent
+	entry.DeleteAfter = nil
+	if err := s.ledger.put(context.Background(), s.client, *entry); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	unlock()
+	<-done
+
+	if f.deletes != 0 || len(f.visible()) != 1 {
+		t.Fatalf("expected the record presented again to be kept, got %d deletes", f.deletes)
+	}
+}
@@ -0,0 +1,89 @@
+package solver
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AnnotationAllowedZones lists the zones a credentials Secret may be used
+	// for, separated by commas or whitespace.
+	AnnotationAllowedZones = "acme.contabo.com/allowed-zones"
+	// AnnotationAllowedFQDNs lists glob patterns (e.g. "_acme-challenge.*.example.com")
+	// matching the challenge FQDNs a credentials Secret may be used for.
+	AnnotationAllowedFQDNs = "acme.contabo.com/allowed-fqdns"
+)
+
+// scope restricts the zones and record names credentials may be used for.
+// A nil list means no restriction.
+type scope struct {
+	source   string
+	zones    []string
+	patterns []string
+}
+
+func scopeFromAnnotations(secret *corev1.Secret) (scope, error) {
+	return parseScope(fmt.Sprintf("secret %s/%s", secret.GetNamespace(), secret.GetName()), secret.GetAnnotations())
+}
+
+// parseScope reads the scope of source from the allowed-zones and
+// allowed-fqdns keys of metadata, the annotations of a Secret or the custom
+// metadata of a Vault secret.
+func parseScope(source string, metadata map[string]string) (scope, error) {
+	sc := scope{source: source}
+
+	if value, ok := metadata[AnnotationAllowedZones]; ok {
+		sc.zones = []string{}
+		for _, zone := range splitList(value) {
+			sc.zones = append(sc.zones, normalizeName(zone))
+		}
+	}
+
+	if value, ok := metadata[AnnotationAllowedFQDNs]; ok {
+		sc.patterns = []string{}
+		for _, pattern := range splitList(value) {
+			pattern = normalizeName(pattern)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return scope{}, fmt.Errorf("%s: invalid pattern %q in %s annotation: %w", sc.source, pattern, AnnotationAllowedFQDNs, err)
+			}
+			sc.patterns = append(sc.patterns, pattern)
+		}
+	}
+
+	return sc, nil
+}
+
+// authorize returns an error if the zone or FQDN falls outside the scope.
+func (sc scope) authorize(zone, fqdn string) error {
+	zone = normalizeName(zone)
+	fqdn = normalizeName(fqdn)
+
+	if sc.zones != nil && !slices.Contains(sc.zones, zone) {
+		return fmt.Errorf("zone %q is not allowed by %s (%s: %q)", zone, sc.source, AnnotationAllowedZones, strings.Join(sc.zones, ","))
+	}
+
+	if sc.patterns != nil {
+		for _, pattern := range sc.patterns {
+			if ok, _ := path.Match(pattern, fqdn); ok {
+				return nil
+			}
+		}
+		return fmt.Errorf("name %q is not allowed by %s (%s: %q)", fqdn, sc.source, AnnotationAllowedFQDNs, strings.Join(sc.patterns, ","))
+	}
+
+	return nil
+}
+
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
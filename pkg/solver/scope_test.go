@@ -0,0 +1,111 @@
+package solver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestScopeAuthorize(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "creds",
+			Namespace: "ns",
+			Annotations: map[string]string{
+				AnnotationAllowedZones: "example.com, Example.org.",
+				AnnotationAllowedFQDNs: "_acme-challenge.example.com _acme-challenge.*.example.com,_acme-challenge.example.org",
+			},
+		},
+	}
+	sc, err := scopeFromAnnotations(secret)
+	if err != nil {
+		t.Fatalf("scope: %v", err)
+	}
+
+	tests := []struct {
+		zone, fqdn string
+		allowed    bool
+	}{
+		{"example.com.", "_acme-challenge.example.com.", true},
+		{"example.com.", "_acme-challenge.www.example.com.", true},
+		{"example.org.", "_acme-challenge.example.org.", true},
+		{"example.org.", "_acme-challenge.www.example.org.", false},
+		{"example.net.", "_acme-challenge.example.net.", false},
+	}
+	for _, tt := range tests {
+		err := sc.authorize(tt.zone, tt.fqdn)
+		if tt.allowed && err != nil {
+			t.Fatalf("%s in %s: expected allowed, got %v", tt.fqdn, tt.zone, err)
+		}
+		if !tt.allowed && err == nil {
+			t.Fatalf("%s in %s: expected denial", tt.fqdn, tt.zone)
+		}
+	}
+
+	if err := (scope{}).authorize("anything.com", "_acme-challenge.anything.com"); err != nil {
+		t.Fatalf("expected unrestricted scope, got %v", err)
+	}
+}
+
+func TestScopeInvalidPattern(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "creds",
+			Namespace:   "ns",
+			Annotations: map[string]string{AnnotationAllowedFQDNs: "[example.com"},
+		},
+	}
+	if _, err := scopeFromAnnotations(secret); err == nil {
+		t.Fatalf("expected error for invalid pattern")
+	}
+}
+
+func TestSolverRefusesOutOfScopeChallenge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected Contabo request: %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "contabo-credentials",
+			Namespace:   "tenant-ns",
+			Annotations: map[string]string{AnnotationAllowedZones: "example.org"},
+		},
+		Data: map[string][]byte{
+			secretKeyClientID:     []byte("id"),
+			secretKeyClientSecret: []byte("secret"),
+			secretKeyUsername:     []byte("user"),
+			secretKeyPassword:     []byte("pass"),
+		},
+	}
+	cfgJSON, _ := json.Marshal(Config{
+		CredentialsSecretName: "contabo-credentials",
+		BaseURL:               server.URL,
+		AuthURL:               server.URL + "/token",
+	})
+	challenge := &v1alpha1.ChallengeRequest{
+		ResourceNamespace: "tenant-ns",
+		ResolvedZone:      "example.com.",
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		Key:               "key",
+		Config:            &apiextensionsv1.JSON{Raw: cfgJSON},
+	}
+
+	s := NewSolver()
+	s.client = kubefake.NewSimpleClientset(secret)
+	if err := s.Present(challenge); err == nil {
+		t.Fatalf("expected Present to be refused")
+	}
+	if err := s.CleanUp(challenge); err == nil {
+		t.Fatalf("expected CleanUp to be refused")
+	}
+}
@@ -2,216 +2,387 @@ package solver
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"cert-manager-webhook-contabo/pkg/audit"
 	"cert-manager-webhook-contabo/pkg/contabo"
+	"cert-manager-webhook-contabo/pkg/metrics"
+	"cert-manager-webhook-contabo/pkg/vault"
 
 	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 	corev1 "k8s.io/api/core/v1"
-	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
 
-const (
-	defaultTTL            = 120
-	defaultTimeout        = 15 * time.Second
-	secretKeyClientID     = "clientId"
-	secretKeyClientSecret = "clientSecret"
-	secretKeyUsername     = "username"
-	secretKeyPassword     = "password"
-)
-
 // Solver implements the cert-manager webhook Solver interface.
 type Solver struct {
 	client kubernetes.Interface
-}
 
-type credentials struct {
-	clientID     string
-	clientSecret string
-	username     string
-	password     string
+	clusterResourceNamespace string
+	namespaceGrants          []NamespaceGrant
+	ambient                  func() (*credentials, error)
+	credentialsFilesDir      string
+	vault                    *vault.Client
+	ledger                   *ledger
+	gc                       *GCOptions
+	dynamic                  dynamic.Interface
+	reconcileGroupName       string
+	findZone                 func(ctx context.Context, fqdn string) (string, error)
+	followCNAME              func(ctx context.Context, fqdn string) (string, error)
+
+	locks    recordLocks
+	inflight singleflight.Group
+	leases   *leaseLocker
+	cleanups cleanupScheduler
+	// delegations caches the CNAMEs verified by ensureDelegation.
+	delegations sync.Map
+	// presentDeadline bounds all of Present.
+	presentDeadline time.Duration
+
+	recorder      record.EventRecorder
+	challengeRefs sync.Map
+	challenges    cache.SharedIndexInformer
+
+	tracerProvider trace.TracerProvider
+	auditSink      audit.Sink
+	dryRun         bool
+
+	// defaultProfile is served as DefaultProfileName, profiles under their
+	// own names.
+	defaultProfile *profile
+	profiles       []*profile
 }
 
-func NewSolver() *Solver {
-	return &Solver{}
+// Option configures webhook-wide Solver behaviour.
+type Option func(*Solver)
+
+func NewSolver(opts ...Option) *Solver {
+	s := &Solver{
+		clusterResourceNamespace: DefaultClusterResourceNamespace,
+		findZone:                 findZoneByNS,
+		followCNAME:              followCNAMEByDNS,
+		presentDeadline:          defaultPresentDeadline,
+		defaultProfile:           &profile{name: DefaultProfileName},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Solver) Name() string {
-	return "contabo"
+	return s.defaultProfile.name
 }
 
-func (s *Solver) Initialize(restConfig *rest.Config, _ <-chan struct{}) error {
+func (s *Solver) Initialize(restConfig *rest.Config, stopCh <-chan struct{}) error {
 	client, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		return fmt.Errorf("failed to initialize kubernetes client: %w", err)
 	}
 	s.client = client
-	return nil
-}
+	s.recorder = newEventRecorder(client, stopCh)
 
-func (s *Solver) Present(ch *v1alpha1.ChallengeRequest) error {
-	cfg, err := loadConfig(ch.Config)
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
 	if err != nil {
+		return fmt.Errorf("failed to initialize dynamic client: %w", err)
+	}
+	s.dynamic = dynamicClient
+	if err := s.watchChallenges(stopCh); err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout())
+	if s.gc != nil {
+		if s.ledger == nil {
+			return fmt.Errorf("the garbage collector requires the ledger to be enabled")
+		}
+		go s.runGarbageCollector(stopCh)
+	}
+	if s.ledger != nil {
+		go s.resumeScheduledCleanUps()
+	}
+	if s.reconcileGroupName != "" {
+		go s.runStartupReconciler(stopCh)
+	}
+	if s.defaultProfile.defaultsPath != "" {
+		go s.defaultProfile.watchDefaults(stopCh)
+	}
+	return nil
+}
+
+func (s *Solver) Present(ch *v1alpha1.ChallengeRequest) error {
+	return s.present(s.defaultProfile, ch)
+}
+
+func (s *Solver) present(p *profile, ch *v1alpha1.ChallengeRequest) (err error) {
+	start := time.Now()
+	ctx, span := s.startSpan(withProfile(context.Background(), p), "Present", ch)
+	ctx = withChallengeLogger(ctx, ch)
+	ctx, cancel := context.WithTimeout(ctx, s.presentDeadline)
+	defer cancel()
+	defer func() {
+		err = observeError(ctx, v1alpha1.ChallengeActionPresent, err)
+		endSpan(span, err)
+		metrics.ObserveOperation(string(v1alpha1.ChallengeActionPresent), normalizeZone(ch.ResolvedZone), start, err)
+	}()
+	return s.coalesce(v1alpha1.ChallengeActionPresent, ch, func() error {
+		cfg, err := s.loadConfig(ctx, ch.Config)
+		if err != nil {
+			return s.configError(ch, err)
+		}
+		target := delegatedChallenge(cfg, ch)
+		if target != ch {
+			ctx = withRecordLogger(ctx, target)
+			if err := s.ensureDelegation(ctx, cfg, ch, target); err != nil {
+				return err
+			}
+		}
+
+		if !s.isDryRun(cfg) {
+			s.cancelScheduledCleanUp(ctx, target)
+		}
+		if err := s.presentRecord(ctx, target, cfg); err != nil {
+			return err
+		}
+		if s.isDryRun(cfg) {
+			return nil
+		}
+		// The record lock is released by now, so another challenge for the
+		// same name can proceed while this one waits for DNS.
+		return waitForPropagation(ctx, cfg.PropagationCheck, normalizeZone(target.ResolvedZone), target.ResolvedFQDN, ch.Key)
+	})
+}
+
+// presentRecord makes sure the challenge's TXT record exists, holding the
+// record lock for its zone and name.
+func (s *Solver) presentRecord(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *Config) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.operationTimeout())
 	defer cancel()
 
 	creds, err := s.loadCredentials(ctx, ch, cfg)
 	if err != nil {
-		return err
+		return s.credentialsError(ch, err)
 	}
 
-	client, err := s.newClient(cfg, creds)
+	zone := normalizeZone(ch.ResolvedZone)
+	recordName := relativeRecordName(ch.ResolvedFQDN, ch.ResolvedZone)
+	defer s.locks.lock(zone, recordName)()
+
+	if err := creds.authorize(zone, ch.ResolvedFQDN); err != nil {
+		return s.permissionError(ch, err)
+	}
+
+	ctx, unlock, err := s.lockZone(ctx, creds, zone)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	zone := normalizeZone(ch.ResolvedZone)
-	recordName := relativeRecordName(ch.ResolvedFQDN, ch.ResolvedZone)
+	client, err := s.newClient(cfg, creds)
+	if err != nil {
+		return s.credentialsError(ch, err)
+	}
 
 	existing, err := client.ListRecords(ctx, zone, recordName)
 	if err != nil {
+		return s.apiError(ch, zoneError(ctx, client, zone, err))
+	}
+	if err := s.handleStaleRecords(ctx, client, creds, cfg, ch, zone, recordName, existing); err != nil {
 		return err
 	}
+
+	present := false
+	var recordID int64
 	for _, record := range existing {
 		if isACMERecord(record, recordName, ch.Key) {
-			klog.Infof("TXT record %s in zone %s already present, skipping create", recordName, zone)
-			return nil
+			klog.FromContext(ctx).Info("TXT record already present, skipping create", "recordName", recordName, "recordID", record.RecordID)
+			s.event(ch, corev1.EventTypeNormal, EventReasonRecordAlreadyPresent, "TXT record %s (%d) in zone %s already present", recordName, record.RecordID, zone)
+			present = true
+			recordID = record.RecordID
+			break
+		}
+	}
+
+	if s.isDryRun(cfg) {
+		if !present {
+			s.skipChange(ctx, ch, "create TXT record %s in zone %s", recordName, zone)
 		}
+		return nil
 	}
 
-	req := contabo.CreateRecordRequest{
-		Name: recordName,
-		Type: "TXT",
-		TTL:  cfg.ttl(),
-		Prio: 0,
-		Data: ch.Key,
+	if !present {
+		req := contabo.CreateRecordRequest{
+			Name: recordName,
+			Type: "TXT",
+			TTL:  cfg.ttl(),
+			Prio: 0,
+			Data: ch.Key,
+		}
+
+		if err := s.markPending(ctx, ch, zone, recordName); err != nil {
+			return err
+		}
+		klog.FromContext(ctx).Info("Creating TXT record", "recordName", recordName)
+		if err := client.CreateRecord(ctx, zone, req); err != nil {
+			s.recordAudit(ctx, ch, creds, audit.ActionCreate, auditReasonPresent, zone, recordName, "TXT", 0, err)
+			return s.apiError(ch, err)
+		}
+		s.event(ch, corev1.EventTypeNormal, EventReasonRecordCreated, "Created TXT record %s in zone %s", recordName, zone)
+		verifyErr := verifyRecords(ctx, client, cfg.VerifyChanges, zone, recordName, func(records []contabo.DNSRecord) bool {
+			return slices.ContainsFunc(records, func(r contabo.DNSRecord) bool { return isACMERecord(r, recordName, ch.Key) })
+		})
+		// The record was created even if verification failed, so it is
+		// audited either way, with its ID if the API lists it.
+		if s.auditSink != nil {
+			recordID = findRecordID(ctx, client, zone, recordName, ch.Key)
+		}
+		s.recordAudit(ctx, ch, creds, audit.ActionCreate, auditReasonPresent, zone, recordName, "TXT", recordID, nil)
+		if verifyErr != nil {
+			return verifyErr
+		}
 	}
 
-	klog.Infof("creating TXT record %s in zone %s", recordName, zone)
-	return client.CreateRecord(ctx, zone, req)
+	if err := s.recordInLedger(ctx, client, ch, zone, recordName, recordID); err != nil {
+		return err
+	}
+	return nil
 }
 
 func (s *Solver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
-	cfg, err := loadConfig(ch.Config)
+	return s.cleanUp(s.defaultProfile, ch)
+}
+
+func (s *Solver) cleanUp(p *profile, ch *v1alpha1.ChallengeRequest) (err error) {
+	start := time.Now()
+	ctx, span := s.startSpan(withProfile(context.Background(), p), "CleanUp", ch)
+	ctx = withChallengeLogger(ctx, ch)
+	defer func() {
+		err = observeError(ctx, v1alpha1.ChallengeActionCleanUp, err)
+		endSpan(span, err)
+		metrics.ObserveOperation(string(v1alpha1.ChallengeActionCleanUp), normalizeZone(ch.ResolvedZone), start, err)
+	}()
+	return s.coalesce(v1alpha1.ChallengeActionCleanUp, ch, func() error {
+		cfg, err := s.loadConfig(ctx, ch.Config)
+		if err != nil {
+			return s.configError(ch, err)
+		}
+		target := delegatedChallenge(cfg, ch)
+		if cfg.CleanupDelay != nil && cfg.CleanupDelay.Duration > 0 && !s.isDryRun(cfg) {
+			return s.scheduleCleanUp(ctx, target, time.Now().Add(cfg.CleanupDelay.Duration))
+		}
+		return s.cleanUpRecord(ctx, target, false)
+	})
+}
+
+// cleanUpRecord deletes the challenge's TXT record, holding the record lock for
+// its zone and name. A scheduled deletion only goes ahead if the ledger still
+// schedules it once the locks are held.
+func (s *Solver) cleanUpRecord(ctx context.Context, ch *v1alpha1.ChallengeRequest, scheduled bool) error {
+	cfg, err := s.loadConfig(ctx, ch.Config)
 	if err != nil {
-		return err
+		return s.configError(ch, err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout())
+	ctx, cancel := context.WithTimeout(ctx, cfg.operationTimeout())
 	defer cancel()
 
 	creds, err := s.loadCredentials(ctx, ch, cfg)
 	if err != nil {
-		return err
-	}
-
-	client, err := s.newClient(cfg, creds)
-	if err != nil {
-		return err
+		return s.credentialsError(ch, err)
 	}
 
 	zone := normalizeZone(ch.ResolvedZone)
 	recordName := relativeRecordName(ch.ResolvedFQDN, ch.ResolvedZone)
+	defer s.locks.lock(zone, recordName)()
+
+	if err := creds.authorize(zone, ch.ResolvedFQDN); err != nil {
+		return s.permissionError(ch, err)
+	}
 
-	records, err := client.ListRecords(ctx, zone, recordName)
+	ctx, unlock, err := s.lockZone(ctx, creds, zone)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	var delErrs []error
-	for _, record := range records {
-		if !isACMERecord(record, recordName, ch.Key) {
-			continue
+	if scheduled && s.ledger != nil && ch.UID != "" {
+		due, err := s.scheduledCleanUpDue(ctx, ch)
+		if err != nil {
+			return fmt.Errorf("failed to read ledger before deferred deletion: %w", err)
 		}
-		klog.Infof("deleting TXT record %s (%d) in zone %s", record.Name, record.RecordID, zone)
-		if err := client.DeleteRecord(ctx, zone, fmt.Sprint(record.RecordID)); err != nil {
-			delErrs = append(delErrs, fmt.Errorf("delete record %d: %w", record.RecordID, err))
+		if !due {
+			klog.FromContext(ctx).V(2).Info("Deferred deletion of TXT record is no longer scheduled in the ledger, skipping it")
+			return nil
 		}
 	}
 
-	return errors.Join(delErrs...)
-}
-
-func (s *Solver) newClient(cfg *Config, creds *credentials) (*contabo.Client, error) {
-	if cfg.AuthURL != "" {
-		return contabo.NewClientWithAuthURL(cfg.BaseURL, cfg.AuthURL, creds.clientID, creds.clientSecret, creds.username, creds.password, cfg.timeout())
+	client, err := s.newClient(cfg, creds)
+	if err != nil {
+		return s.credentialsError(ch, err)
 	}
-	return contabo.NewClient(cfg.BaseURL, creds.clientID, creds.clientSecret, creds.username, creds.password, cfg.timeout())
-}
 
-func (s *Solver) loadCredentials(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *Config) (*credentials, error) {
-	if s.client == nil {
-		return nil, fmt.Errorf("kubernetes client is not initialized")
+	// Delete exactly the record this challenge created when the ledger knows
+	// its ID, otherwise every TXT record with the challenge's name and key.
+	var ids []int64
+	if entry := s.ledgerEntryFor(ctx, ch, zone); entry != nil && entry.RecordID != 0 {
+		ids = append(ids, entry.RecordID)
+	} else {
+		records, err := client.ListRecords(ctx, zone, recordName)
+		if err != nil {
+			return s.apiError(ch, zoneError(ctx, client, zone, err))
+		}
+		for _, record := range records {
+			if isACMERecord(record, recordName, ch.Key) {
+				ids = append(ids, record.RecordID)
+			}
+		}
 	}
 
-	namespace := cfg.CredentialsSecretNamespace
-	if namespace == "" {
-		namespace = ch.ResourceNamespace
-	}
-	if namespace == "" {
-		return nil, fmt.Errorf("credentialsSecretNamespace is required when challenge resource namespace is empty")
+	if s.isDryRun(cfg) {
+		for _, id := range ids {
+			s.skipChange(ctx, ch, "delete TXT record %s (%d) in zone %s", recordName, id, zone)
+		}
+		return nil
 	}
 
-	secret, err := s.client.CoreV1().Secrets(namespace).Get(ctx, cfg.CredentialsSecretName, metav1.GetOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get credentials secret %s/%s: %w", namespace, cfg.CredentialsSecretName, err)
+	var delErrs []error
+	for _, id := range ids {
+		klog.FromContext(ctx).Info("Deleting TXT record", "recordName", recordName, "recordID", id)
+		err := client.DeleteRecord(ctx, zone, fmt.Sprint(id))
+		s.recordAudit(ctx, ch, creds, audit.ActionDelete, auditReasonCleanUp, zone, recordName, "TXT", id, err)
+		if err != nil {
+			delErrs = append(delErrs, fmt.Errorf("delete record %d: %w", id, err))
+			continue
+		}
+		s.event(ch, corev1.EventTypeNormal, EventReasonRecordDeleted, "Deleted TXT record %s (%d) in zone %s", recordName, id, zone)
 	}
-
-	return credentialsFromSecret(secret)
-}
-
-func credentialsFromSecret(secret *corev1.Secret) (*credentials, error) {
-	clientID := strings.TrimSpace(string(secret.Data[secretKeyClientID]))
-	clientSecret := strings.TrimSpace(string(secret.Data[secretKeyClientSecret]))
-	username := strings.TrimSpace(string(secret.Data[secretKeyUsername]))
-	password := strings.TrimSpace(string(secret.Data[secretKeyPassword]))
-
-	if clientID == "" || clientSecret == "" || username == "" || password == "" {
-		return nil, fmt.Errorf(
-			"secret %s/%s must contain non-empty %q, %q, %q, and %q keys",
-			secret.GetNamespace(),
-			secret.GetName(),
-			secretKeyClientID,
-			secretKeyClientSecret,
-			secretKeyUsername,
-			secretKeyPassword,
-		)
-	}
-
-	return &credentials{
-		clientID:     clientID,
-		clientSecret: clientSecret,
-		username:     username,
-		password:     password,
-	}, nil
-}
-
-func loadConfig(rawJSON *apiextensionsv1.JSON) (*Config, error) {
-	if rawJSON == nil {
-		return nil, fmt.Errorf("config is required")
+	if len(delErrs) > 0 {
+		return s.apiError(ch, errors.Join(delErrs...))
 	}
+	s.removeFromLedger(ctx, ch)
+	s.challengeRefs.Delete(ch.UID)
 
-	var cfg Config
-	if err := json.Unmarshal(rawJSON.Raw, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
-	}
+	return verifyRecords(ctx, client, cfg.VerifyChanges, zone, recordName, func(records []contabo.DNSRecord) bool {
+		return !slices.ContainsFunc(records, func(r contabo.DNSRecord) bool { return isACMERecord(r, recordName, ch.Key) })
+	})
+}
 
-	if cfg.CredentialsSecretName == "" {
-		return nil, fmt.Errorf("credentialsSecretName is required")
+func (s *Solver) newClient(cfg *Config, creds *credentials) (*contabo.Client, error) {
+	if cfg.AuthURL != "" {
+		return contabo.NewClientWithAuthURL(cfg.BaseURL, cfg.AuthURL, creds.clientID, creds.clientSecret, creds.username, creds.password, cfg.timeout())
 	}
-
-	return &cfg, nil
+	return contabo.NewClient(cfg.BaseURL, creds.clientID, creds.clientSecret, creds.username, creds.password, cfg.timeout())
 }
 
 func normalizeZone(zone string) string {
@@ -251,17 +422,3 @@ func isACMERecord(record contabo.DNSRecord, name, value string) bool {
 	}
 	return true
 }
-
-func (c *Config) ttl() int {
-	if c.TTL <= 0 {
-		return defaultTTL
-	}
-	return c.TTL
-}
-
-func (c *Config) timeout() time.Duration {
-	if c.TimeoutSecs <= 0 {
-		return defaultTimeout
-	}
-	return time.Duration(c.TimeoutSecs) * time.Second
-}
@@ -8,10 +8,13 @@ import (
 	"testing"
 
 	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"cert-manager-webhook-contabo/pkg/metrics"
 )
 
 func TestSolverPresentAndCleanUp(t *testing.T) {
@@ -143,16 +146,20 @@ func TestNormalizeZone(t *testing.T) {
 }
 
 func TestSolverLoadConfigErrors(t *testing.T) {
-	if _, err := loadConfig(nil); err == nil {
+	if _, err := NewSolver().loadConfig(t.Context(), nil); err == nil {
 		t.Fatalf("expected error for nil config")
 	}
 
 	cfgJSON, _ := json.Marshal(Config{})
-	if _, err := loadConfig(&apiextensionsv1.JSON{Raw: cfgJSON}); err == nil {
+	cfg, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: cfgJSON})
+	if err != nil {
+		t.Fatalf("unexpected error for config without secret name: %v", err)
+	}
+	if _, err := NewSolver().loadCredentials(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "ns"}, cfg); err == nil {
 		t.Fatalf("expected error for missing secret name")
 	}
 
-	if _, err := loadConfig(&apiextensionsv1.JSON{Raw: []byte("not-json")}); err == nil {
+	if _, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: []byte("not-json")}); err == nil {
 		t.Fatalf("expected error for bad json")
 	}
 }
@@ -179,3 +186,32 @@ func TestCredentialsFromSecretErrors(t *testing.T) {
 		t.Fatalf("expected error for incomplete secret")
 	}
 }
+
+func TestSolverOperationMetrics(t *testing.T) {
+	f := newFakeContabo(t, "metrics.example.com")
+	s, ch := newTestSolver(t, f, nil)
+	operations := func(operation, result string) float64 {
+		return testutil.ToFloat64(metrics.Operations.WithLabelValues(operation, "metrics.example.com", result))
+	}
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	ch.Config = &apiextensionsv1.JSON{Raw: []byte(`{}`)}
+	if err := s.Present(ch); err == nil {
+		t.Fatalf("expected present without credentials to fail")
+	}
+
+	if got := operations("Present", metrics.ResultSuccess); got != 1 {
+		t.Fatalf("expected 1 successful present, got %v", got)
+	}
+	if got := operations("Present", metrics.ResultError); got != 1 {
+		t.Fatalf("expected 1 failed present, got %v", got)
+	}
+	if got := operations("CleanUp", metrics.ResultSuccess); got != 1 {
+		t.Fatalf("expected 1 successful cleanup, got %v", got)
+	}
+}
@@ -0,0 +1,136 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+
+	"cert-manager-webhook-contabo/pkg/audit"
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+// Stale record actions.
+const (
+	StaleRecordsKeep   = "Keep"
+	StaleRecordsDelete = "Delete"
+	StaleRecordsFail   = "Fail"
+)
+
+const defaultStaleRecordAge = time.Hour
+
+func (p *StaleRecordPolicy) validate(fldPath *field.Path) field.ErrorList {
+	if p == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	switch p.Action {
+	case "", StaleRecordsKeep, StaleRecordsDelete, StaleRecordsFail:
+	default:
+		errs = append(errs, field.NotSupported(fldPath.Child("action"), p.Action, []string{StaleRecordsKeep, StaleRecordsDelete, StaleRecordsFail}))
+	}
+	if p.OlderThanMinutes < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("olderThanMinutes"), p.OlderThanMinutes, "must not be negative"))
+	}
+	return errs
+}
+
+func (p *StaleRecordPolicy) action() string {
+	if p == nil || p.Action == "" {
+		return StaleRecordsKeep
+	}
+	return p.Action
+}
+
+func (p *StaleRecordPolicy) minAge() time.Duration {
+	if p.OlderThanMinutes <= 0 {
+		return defaultStaleRecordAge
+	}
+	return time.Duration(p.OlderThanMinutes) * time.Minute
+}
+
+// handleStaleRecords applies the stale record policy to records, the TXT
+// records listed at recordName before the challenge's own is created. The
+// ledger provides the age of records; without it, nothing could tell a stale
+// value from the sibling challenge presented a moment ago. Records it doesn't
+// know are only logged unless the policy includes them.
+func (s *Solver) handleStaleRecords(ctx context.Context, client *contabo.Client, creds *credentials, cfg *Config, ch *v1alpha1.ChallengeRequest, zone, recordName string, records []contabo.DNSRecord) error {
+	policy := cfg.StaleRecords
+	action := policy.action()
+	if action == StaleRecordsKeep {
+		return nil
+	}
+	if s.ledger == nil {
+		return &Error{Class: ErrorClassConfiguration, Err: fmt.Errorf("staleRecords.action %s requires the webhook's record ledger to be enabled", action)}
+	}
+
+	entries, err := s.ledger.list(ctx, s.client)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var stale []contabo.DNSRecord
+	owners := map[int64]string{}
+	for _, record := range records {
+		if !isACMERecord(record, recordName, "") || record.Data == ch.Key || slices.Contains(policy.ProtectedValues, record.Data) {
+			continue
+		}
+		i := slices.IndexFunc(entries, func(e ledgerEntry) bool {
+			return e.Zone == zone && e.matches(record, recordName)
+		})
+		switch {
+		case i >= 0:
+			if now.Sub(entries[i].CreatedAt) < policy.minAge() {
+				continue
+			}
+			owners[record.RecordID] = entries[i].ChallengeUID
+		case !policy.IncludeUnknown:
+			klog.FromContext(ctx).Info("Leaving TXT record that is not in the ledger, set staleRecords.includeUnknown to treat it as stale", "recordName", recordName, "recordID", record.RecordID)
+			continue
+		}
+		stale = append(stale, record)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if action == StaleRecordsFail {
+		ids := make([]string, 0, len(stale))
+		for _, record := range stale {
+			ids = append(ids, fmt.Sprint(record.RecordID))
+		}
+		return &Error{Class: ErrorClassConfiguration, Err: fmt.Errorf("found %d stale TXT records %s in zone %s (record IDs %s); delete them or add their values to staleRecords.protectedValues",
+			len(stale), recordName, zone, strings.Join(ids, ", "))}
+	}
+
+	if s.isDryRun(cfg) {
+		for _, record := range stale {
+			s.skipChange(ctx, ch, "delete stale TXT record %s (%d) in zone %s", recordName, record.RecordID, zone)
+		}
+		return nil
+	}
+
+	var errs []error
+	for _, record := range stale {
+		klog.FromContext(ctx).Info("Deleting stale TXT record", "recordName", recordName, "recordID", record.RecordID)
+		err := client.DeleteRecord(ctx, zone, fmt.Sprint(record.RecordID))
+		s.recordAudit(ctx, ch, creds, audit.ActionDelete, auditReasonStale, zone, recordName, "TXT", record.RecordID, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("delete stale record %d: %w", record.RecordID, err))
+			continue
+		}
+		if uid, ok := owners[record.RecordID]; ok {
+			if err := s.ledger.remove(ctx, s.client, uid); err != nil {
+				klog.FromContext(ctx).Error(err, "Failed to remove challenge from ledger", "ownerUID", uid)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
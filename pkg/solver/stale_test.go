@@ -0,0 +1,121 @@
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+// newStaleRecordsSolver presents a sibling challenge and seeds the zone with an
+// old ledger record, an unknown record and a protected one.
+func newStaleRecordsSolver(t *testing.T, policy StaleRecordPolicy) (*fakeContabo, *Solver, func() error) {
+	t.Helper()
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		policy.ProtectedValues = []string{"manual"}
+		cfg.StaleRecords = &policy
+	})
+	WithLedger("webhook-ns")(s)
+
+	sibling := *ch
+	sibling.UID = "sibling-uid"
+	sibling.Key = "sibling"
+	if err := s.Present(&sibling); err != nil {
+		t.Fatalf("present sibling: %v", err)
+	}
+
+	oldID := f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "old"})
+	err := s.ledger.put(context.Background(), s.client, ledgerEntry{
+		ChallengeUID: "old-uid", Zone: "example.com", FQDN: ch.ResolvedFQDN, RecordID: oldID,
+		Value: "old", State: ledgerStatePresent, CreatedAt: time.Now().Add(-2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "unknown"})
+	f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "manual"})
+	f.add(contabo.DNSRecord{Name: "_acme-challenge.sub", Type: "TXT", Data: "other-name"})
+
+	return f, s, func() error { return s.Present(ch) }
+}
+
+func visibleValues(f *fakeContabo) string {
+	var values []string
+	for _, record := range f.visible() {
+		values = append(values, record.Data)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func TestStaleRecordsDelete(t *testing.T) {
+	f, s, present := newStaleRecordsSolver(t, StaleRecordPolicy{Action: StaleRecordsDelete})
+	if err := present(); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if got := visibleValues(f); got != "key,manual,other-name,sibling,unknown" {
+		t.Fatalf("expected only the old value to be deleted, got %s", got)
+	}
+	if entry, _ := s.ledger.get(context.Background(), s.client, "old-uid"); entry != nil {
+		t.Fatalf("expected the stale record's ledger entry to be removed")
+	}
+}
+
+func TestStaleRecordsDeleteUnknown(t *testing.T) {
+	f, _, present := newStaleRecordsSolver(t, StaleRecordPolicy{Action: StaleRecordsDelete, IncludeUnknown: true})
+	if err := present(); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if got := visibleValues(f); got != "key,manual,other-name,sibling" {
+		t.Fatalf("expected old and unknown values to be deleted, got %s", got)
+	}
+}
+
+func TestStaleRecordsFail(t *testing.T) {
+	f, _, present := newStaleRecordsSolver(t, StaleRecordPolicy{Action: StaleRecordsFail})
+	err := present()
+	if err == nil || !strings.Contains(err.Error(), "found 1 stale TXT records") {
+		t.Fatalf("expected stale records error, got %v", err)
+	}
+	if f.creates != 1 || f.deletes != 0 {
+		t.Fatalf("expected no changes, got %d creates and %d deletes", f.creates, f.deletes)
+	}
+}
+
+func TestStaleRecordsKeepByDefault(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	f.add(contabo.DNSRecord{Name: "_acme-challenge", Type: "TXT", Data: "old"})
+	s, ch := newTestSolver(t, f, nil)
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if got := visibleValues(f); got != "key,old" {
+		t.Fatalf("expected stale value to be kept, got %s", got)
+	}
+}
+
+func TestStaleRecordsRequiresLedger(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.StaleRecords = &StaleRecordPolicy{Action: StaleRecordsDelete}
+	})
+	if err := s.Present(ch); err == nil || !strings.Contains(err.Error(), "ledger") {
+		t.Fatalf("expected ledger error, got %v", err)
+	}
+}
+
+func TestStaleRecordsConfigValidation(t *testing.T) {
+	for _, policy := range []StaleRecordPolicy{{Action: "Purge"}, {Action: StaleRecordsDelete, OlderThanMinutes: -1}} {
+		raw, _ := json.Marshal(Config{StaleRecords: &policy})
+		if _, err := NewSolver().loadConfig(t.Context(), &apiextensionsv1.JSON{Raw: raw}); err == nil {
+			t.Fatalf("expected %+v to be rejected", policy)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package solver
+
+import (
+	"context"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"cert-manager-webhook-contabo/pkg/tracing"
+)
+
+// Attributes of the solver's spans.
+const (
+	attrChallengeUID       = attribute.Key("challenge.uid")
+	attrChallengeNamespace = attribute.Key("challenge.resource_namespace")
+	attrChallengeFQDN      = attribute.Key("challenge.fqdn")
+	attrChallengeZone      = attribute.Key("challenge.zone")
+	attrCredentialsSource  = attribute.Key("credentials.source")
+	attrSecretNamespace    = attribute.Key("secret.namespace")
+	attrSecretName         = attribute.Key("secret.name")
+)
+
+// WithTracerProvider sets the TracerProvider of the solver's spans. It
+// defaults to the global one, which tracing.Setup configures.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *Solver) {
+		s.tracerProvider = provider
+	}
+}
+
+// startSpan starts a span named name for ch. Spans of the Contabo client
+// started under the returned context become its children.
+func (s *Solver) startSpan(ctx context.Context, name string, ch *v1alpha1.ChallengeRequest) (context.Context, trace.Span) {
+	provider := s.tracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracing.TracerName).Start(ctx, name, trace.WithAttributes(
+		attrChallengeUID.String(string(ch.UID)),
+		attrChallengeNamespace.String(ch.ResourceNamespace),
+		attrChallengeFQDN.String(ch.ResolvedFQDN),
+		attrChallengeZone.String(normalizeZone(ch.ResolvedZone)),
+	))
+}
+
+// endSpan ends span, marking it failed if err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,87 @@
+package solver
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+func newTestTracer(s *Solver) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))(s)
+	return exporter
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) string {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracingPresentSpans(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, nil)
+	exporter := newTestTracer(s)
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	var root tracetest.SpanStub
+	names := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		names[span.Name] = span
+		if span.Name == "Present" {
+			root = span
+		}
+	}
+	if root.Name == "" {
+		t.Fatalf("expected a Present span, got %v", names)
+	}
+	if got := spanAttribute(root, attrChallengeUID); got != "challenge-uid" {
+		t.Fatalf("expected the challenge UID on the span, got %q", got)
+	}
+	if got := spanAttribute(root, attrChallengeZone); got != "example.com" {
+		t.Fatalf("expected the zone on the span, got %q", got)
+	}
+
+	for _, name := range []string{"LoadCredentials", "GetSecret", "contabo.FetchToken", "GET /v1/dns/zones/{zone}/records", "POST /v1/dns/zones/{zone}/records"} {
+		span, ok := names[name]
+		if !ok {
+			t.Fatalf("expected a %s span, got %v", name, names)
+		}
+		if span.SpanContext.TraceID() != root.SpanContext.TraceID() {
+			t.Fatalf("expected %s to be part of the Present trace", name)
+		}
+	}
+	create := names["POST /v1/dns/zones/{zone}/records"]
+	if spanAttribute(create, contabo.RequestIDKey) == "" {
+		t.Fatalf("expected the request ID on the create span")
+	}
+}
+
+func TestTracingRecordsErrors(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	s, ch := newTestSolver(t, f, func(cfg *Config) { cfg.CredentialsSecretName = "missing" })
+	exporter := newTestTracer(s)
+
+	if err := s.Present(ch); err == nil {
+		t.Fatalf("expected present to fail")
+	}
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "Present" || span.Name == "GetSecret" {
+			if span.Status.Code != codes.Error {
+				t.Fatalf("expected %s to be marked failed, got %v", span.Name, span.Status)
+			}
+		}
+	}
+}
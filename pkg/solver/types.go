@@ -1,11 +1,146 @@
 package solver
 
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 // Config is the JSON webhook config passed via the Issuer/ClusterIssuer.
 type Config struct {
+	// APIVersion is the version of the config schema. Defaults to v1.
+	APIVersion                 string `json:"apiVersion,omitempty"`
 	CredentialsSecretName      string `json:"credentialsSecretName"`
 	CredentialsSecretNamespace string `json:"credentialsSecretNamespace,omitempty"`
-	BaseURL                    string `json:"baseUrl"`
-	AuthURL                    string `json:"authUrl"`
-	TTL                        int    `json:"ttl"`
-	TimeoutSecs                int    `json:"timeoutSeconds"`
+	// CredentialsSecretRef references a single Secret whose keys may differ
+	// from the defaults. Only one of CredentialsSecretName,
+	// CredentialsSecretRef, Credentials and Vault may be set.
+	CredentialsSecretRef *SecretRef `json:"credentialsSecretRef,omitempty"`
+	// Credentials sources every credential field separately, from Secrets or
+	// files mounted into the webhook pod.
+	Credentials *CredentialSources `json:"credentials,omitempty"`
+	// Vault reads credentials from a Vault KV v2 secret using the webhook's
+	// Vault connection.
+	Vault       *VaultSource `json:"vault,omitempty"`
+	BaseURL     string       `json:"baseUrl"`
+	AuthURL     string       `json:"authUrl"`
+	TTL         int          `json:"ttl"`
+	TimeoutSecs int          `json:"timeoutSeconds"`
+	// PropagationCheck makes Present wait until every authoritative
+	// nameserver of the zone serves the TXT record.
+	PropagationCheck *PropagationCheck `json:"propagationCheck,omitempty"`
+	// VerifyChanges makes Present and CleanUp re-list the zone's records
+	// until the Contabo API reflects the change.
+	VerifyChanges *ChangeVerification `json:"verifyChanges,omitempty"`
+	// CleanupDelay keeps the TXT record for this long after CleanUp, for CAs
+	// that re-check validation shortly after issuance. CleanUp then returns
+	// immediately and the deletion runs in the background.
+	CleanupDelay *metav1.Duration `json:"cleanupDelay,omitempty"`
+	// StaleRecords decides what Present does with other TXT values left at
+	// the challenge's name by earlier attempts.
+	StaleRecords *StaleRecordPolicy `json:"staleRecords,omitempty"`
+	// Delegation writes TXT records to a dedicated validation zone, reached
+	// through a CNAME at _acme-challenge.<domain> in the challenge's zone.
+	Delegation *Delegation `json:"delegation,omitempty"`
+	// DryRun runs Present and CleanUp up to listing the zone's records, but
+	// only logs and records events for the records they would create or
+	// delete.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// Delegation names the validation zone ACME TXT records are written to. Each
+// challenge name maps to a deterministic name in that zone.
+type Delegation struct {
+	// ValidationZone is the Contabo zone holding the TXT records.
+	ValidationZone string `json:"validationZone"`
+	// EnsureCNAME creates the CNAME in the challenge's zone if it is
+	// missing. This is the only write to that zone. Without it, the CNAME
+	// must already exist.
+	EnsureCNAME bool `json:"ensureCNAME,omitempty"`
+	// Nameservers of the challenge's zone queried to check the CNAME.
+	// Defaults to the zone's NS records.
+	Nameservers []string `json:"nameservers,omitempty"`
+}
+
+// StaleRecordPolicy handles TXT records at the challenge's name whose value is
+// not the challenge key. A record counts as stale once the ledger shows it is
+// older than OlderThanMinutes. Records not in the ledger only count with
+// IncludeUnknown.
+type StaleRecordPolicy struct {
+	// Action is Keep (the default), Delete or Fail.
+	Action string `json:"action,omitempty"`
+	// OlderThanMinutes spares records created recently, such as the record
+	// of the sibling challenge of a wildcard and apex certificate. Defaults
+	// to 60.
+	OlderThanMinutes int `json:"olderThanMinutes,omitempty"`
+	// ProtectedValues are never deleted nor reported as stale.
+	ProtectedValues []string `json:"protectedValues,omitempty"`
+	// IncludeUnknown also counts records the ledger has no entry for as
+	// stale, whatever their age. They may belong to another cluster or
+	// webhook instance sharing the account, so this is off by default.
+	IncludeUnknown bool `json:"includeUnknown,omitempty"`
+}
+
+// SecretRef references a credentials Secret. Namespace defaults to the
+// Challenge resource namespace and empty keys default to clientId,
+// clientSecret, username and password.
+type SecretRef struct {
+	Name      string     `json:"name"`
+	Namespace string     `json:"namespace,omitempty"`
+	Keys      SecretKeys `json:"keys,omitempty"`
+}
+
+// SecretKeys overrides the Secret keys credentials are read from.
+type SecretKeys struct {
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+}
+
+// CredentialSources names where each credential field is read from.
+type CredentialSources struct {
+	ClientID     ValueSource `json:"clientId"`
+	ClientSecret ValueSource `json:"clientSecret"`
+	Username     ValueSource `json:"username"`
+	Password     ValueSource `json:"password"`
+}
+
+// ValueSource reads a single value from either a Secret key or a file.
+type ValueSource struct {
+	SecretKeyRef *SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// File is a path relative to the webhook's --credentials-files-dir.
+	File string `json:"file,omitempty"`
+}
+
+// SecretKeySelector selects a key of a Secret. Namespace defaults to the
+// Challenge resource namespace.
+type SecretKeySelector struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key"`
+}
+
+// VaultSource references a Vault KV v2 secret holding the credentials.
+// Fields maps credential fields to keys of the secret and defaults to
+// clientId, clientSecret, username and password.
+type VaultSource struct {
+	// Mount is the KV v2 mount path. Defaults to "secret".
+	Mount  string     `json:"mount,omitempty"`
+	Path   string     `json:"path"`
+	Fields SecretKeys `json:"fields,omitempty"`
+}
+
+// PropagationCheck configures polling of the zone's authoritative nameservers
+// after a TXT record is presented.
+type PropagationCheck struct {
+	// TimeoutSecs bounds the wait of each Present call, at most 30 seconds.
+	TimeoutSecs  int `json:"timeoutSeconds,omitempty"`
+	IntervalSecs int `json:"intervalSeconds,omitempty"`
+	// Nameservers overrides the zone's NS records. Entries are host or
+	// host:port; the port defaults to 53.
+	Nameservers []string `json:"nameservers,omitempty"`
+}
+
+// ChangeVerification configures polling ListRecords after a record is
+// created or deleted.
+type ChangeVerification struct {
+	TimeoutSecs  int `json:"timeoutSeconds,omitempty"`
+	IntervalSecs int `json:"intervalSeconds,omitempty"`
 }
@@ -0,0 +1,103 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+
+	"cert-manager-webhook-contabo/pkg/vault"
+)
+
+const defaultVaultMount = "secret"
+
+// WithVault enables the vault credentials source using client.
+func WithVault(client *vault.Client) Option {
+	return func(s *Solver) {
+		s.vault = client
+	}
+}
+
+// vaultSource reads all credentials from a Vault KV v2 secret.
+type vaultSource struct {
+	solver *Solver
+	ref    VaultSource
+}
+
+func (src *vaultSource) load(ctx context.Context, ch *v1alpha1.ChallengeRequest) (*credentials, error) {
+	s := src.solver
+	if s.vault == nil {
+		return nil, fmt.Errorf("vault credentials are disabled: the webhook was started without --vault-addr")
+	}
+
+	mount := src.ref.Mount
+	if mount == "" {
+		mount = defaultVaultMount
+	}
+	path := strings.Trim(src.ref.Path, "/")
+	if err := s.checkVaultPath(ch, mount, path); err != nil {
+		return nil, &Error{Class: ErrorClassPermission, Err: err}
+	}
+
+	secret, err := s.vault.ReadKV(ctx, mount, path)
+	if err != nil {
+		return nil, &Error{Class: vaultErrorClass(err), Err: fmt.Errorf("failed to read credentials from vault: %w", err)}
+	}
+	// The custom metadata of the secret restricts it like the annotations
+	// of a credentials Secret.
+	sc, err := parseScope(fmt.Sprintf("vault secret %s/%s", mount, path), secret.CustomMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	data := secret.Data
+	fields := src.ref.Fields.withDefaults()
+	creds := &credentials{
+		clientID:     strings.TrimSpace(data[fields.ClientID]),
+		clientSecret: strings.TrimSpace(data[fields.ClientSecret]),
+		username:     strings.TrimSpace(data[fields.Username]),
+		password:     strings.TrimSpace(data[fields.Password]),
+		scopes:       []scope{sc},
+		source:       fmt.Sprintf("vault %s/%s", mount, path),
+	}
+	if creds.clientID == "" || creds.clientSecret == "" || creds.username == "" || creds.password == "" {
+		return nil, fmt.Errorf(
+			"vault secret %s/%s must contain non-empty %q, %q, %q, and %q fields",
+			mount, path, fields.ClientID, fields.ClientSecret, fields.Username, fields.Password,
+		)
+	}
+	return creds, nil
+}
+
+// checkVaultPath applies the namespace policy of credentials Secrets to Vault
+// paths: the first segment of the path stands for a namespace, and namespaced
+// Issuers may only read paths below a namespace they may read Secrets from,
+// their own or one granted by --allow-secret-namespace. ClusterIssuers may
+// read any path the webhook's Vault role can. Paths with empty, "." or ".."
+// segments are rejected for every issuer, since Vault would resolve them
+// below a different namespace than the first segment names.
+func (s *Solver) checkVaultPath(ch *v1alpha1.ChallengeRequest, mount, path string) error {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("vault path %s/%s must not contain empty, %q or %q segments", mount, path, ".", "..")
+		}
+	}
+	namespace, _, _ := strings.Cut(path, "/")
+	if s.isClusterIssuer(ch) || (namespace != path && s.namespaceAllowed(ch, namespace)) {
+		return nil
+	}
+
+	klog.InfoS("Denied vault credentials path",
+		"audit", true,
+		"challengeUID", ch.UID,
+		"issuerNamespace", ch.ResourceNamespace,
+		"vaultPath", mount+"/"+path,
+		"fqdn", ch.ResolvedFQDN,
+	)
+	return fmt.Errorf(
+		"vault path %s/%s is not readable from issuer namespace %q: namespaced issuers may only read paths below %q",
+		mount, path, ch.ResourceNamespace, ch.ResourceNamespace+"/",
+	)
+}
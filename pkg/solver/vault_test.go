@@ -0,0 +1,95 @@
+package solver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+
+	"cert-manager-webhook-contabo/pkg/vault"
+)
+
+func newFakeVault(t *testing.T) *vault.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/kubernetes/login", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"vault-token","lease_duration":3600}}`))
+	})
+	mux.HandleFunc("/v1/kv/data/tenant-ns/contabo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"client_id":"id","client_secret":"secret","username":"user","password":"pass"},"metadata":{"custom_metadata":{"acme.contabo.com/allowed-zones":"example.com"}}}}`))
+	})
+	mux.HandleFunc("/v1/secret/data/shared/contabo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"data":{"clientId":"id","clientSecret":"secret","username":"user"}}}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	client, err := vault.NewClient(server.URL, "webhook", "", tokenFile, time.Minute, 5*time.Second)
+	if err != nil {
+		t.Fatalf("new vault client: %v", err)
+	}
+	return client
+}
+
+func TestVaultCredentials(t *testing.T) {
+	s := NewSolver(WithVault(newFakeVault(t)))
+	ctx := context.Background()
+	tenant := &v1alpha1.ChallengeRequest{ResourceNamespace: "tenant-ns"}
+
+	cfg := &Config{Vault: &VaultSource{
+		Mount:  "kv",
+		Path:   "tenant-ns/contabo",
+		Fields: SecretKeys{ClientID: "client_id", ClientSecret: "client_secret"},
+	}}
+	creds, err := s.loadCredentials(ctx, tenant, cfg)
+	if err != nil {
+		t.Fatalf("load credentials: %v", err)
+	}
+	if creds.clientID != "id" || creds.clientSecret != "secret" || creds.username != "user" || creds.password != "pass" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+	if err := creds.authorize("example.com", "_acme-challenge.example.com"); err != nil {
+		t.Fatalf("expected the allowed zone to be authorized: %v", err)
+	}
+	if err := creds.authorize("example.org", "_acme-challenge.example.org"); err == nil || !strings.Contains(err.Error(), "vault secret kv/tenant-ns/contabo") {
+		t.Fatalf("expected the custom metadata to restrict zones, got %v", err)
+	}
+
+	shared := &Config{Vault: &VaultSource{Path: "shared/contabo"}}
+	if _, err := s.loadCredentials(ctx, tenant, shared); err == nil || !strings.Contains(err.Error(), "not readable") {
+		t.Fatalf("expected namespace policy denial, got %v", err)
+	}
+
+	clusterIssuer := &v1alpha1.ChallengeRequest{ResourceNamespace: DefaultClusterResourceNamespace}
+	for _, path := range []string{"tenant-ns/../shared/contabo", "tenant-ns/./contabo", "tenant-ns//contabo", ".."} {
+		traversal := &Config{Vault: &VaultSource{Path: path}}
+		for _, ch := range []*v1alpha1.ChallengeRequest{tenant, clusterIssuer} {
+			_, err := s.loadCredentials(ctx, ch, traversal)
+			if err == nil || !strings.Contains(err.Error(), "segments") || ClassOf(err) != ErrorClassPermission {
+				t.Fatalf("expected path %q to be rejected for %q, got %v", path, ch.ResourceNamespace, err)
+			}
+		}
+	}
+
+	if _, err := s.loadCredentials(ctx, clusterIssuer, shared); err == nil || !strings.Contains(err.Error(), `"password"`) {
+		t.Fatalf("expected missing field error, got %v", err)
+	}
+
+	if _, err := NewSolver().loadCredentials(ctx, tenant, cfg); err == nil {
+		t.Fatalf("expected error when vault is not configured")
+	}
+}
@@ -0,0 +1,75 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cert-manager-webhook-contabo/pkg/contabo"
+)
+
+const (
+	defaultVerifyTimeout  = 30 * time.Second
+	maxVerifyTimeoutSecs  = 30
+	defaultVerifyInterval = time.Second
+)
+
+// ErrNotConverged is returned when the Contabo API acknowledged a change that
+// ListRecords never reflected. The operation is safe to retry.
+var ErrNotConverged = errors.New("contabo api did not converge")
+
+// verifyRecords re-lists the records named name until converged reports true
+// or the verification deadline passes. ctx still bounds it, so verification
+// ends early when the operation's deadline passes or its zone lock is lost.
+// It returns nil immediately when v is nil.
+func verifyRecords(ctx context.Context, client *contabo.Client, v *ChangeVerification, zone, name string, converged func([]contabo.DNSRecord) bool) error {
+	if v == nil {
+		return nil
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, v.timeout())
+	defer cancel()
+
+	ticker := time.NewTicker(v.interval())
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		records, err := client.ListRecords(ctx, zone, name)
+		if err == nil && converged(records) {
+			return nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			if cause := context.Cause(ctx); !errors.Is(cause, context.DeadlineExceeded) {
+				return fmt.Errorf("TXT record %s in zone %s not confirmed: %w", name, zone, cause)
+			}
+			waited := time.Since(start).Round(time.Second)
+			if lastErr != nil {
+				return fmt.Errorf("%w: TXT record %s in zone %s not confirmed within %s: %w", ErrNotConverged, name, zone, waited, lastErr)
+			}
+			return fmt.Errorf("%w: TXT record %s in zone %s not confirmed within %s", ErrNotConverged, name, zone, waited)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (v *ChangeVerification) timeout() time.Duration {
+	if v.TimeoutSecs <= 0 {
+		return defaultVerifyTimeout
+	}
+	return time.Duration(v.TimeoutSecs) * time.Second
+}
+
+func (v *ChangeVerification) interval() time.Duration {
+	if v.IntervalSecs <= 0 {
+		return defaultVerifyInterval
+	}
+	return time.Duration(v.IntervalSecs) * time.Second
+}
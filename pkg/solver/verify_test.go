@@ -0,0 +1,73 @@
+package solver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyChangesWaitsForListRecords(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	// Writes show up on the second list call after them, so the first
+	// verification list misses them and verification has to poll again.
+	f.lag = 2
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.VerifyChanges = &ChangeVerification{TimeoutSecs: 5, IntervalSecs: 1}
+	})
+
+	if err := s.Present(ch); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if len(f.visible()) != 1 {
+		t.Fatalf("expected record to be visible after Present returned")
+	}
+	// One list before the create, two to verify it.
+	if f.lists != 3 {
+		t.Fatalf("expected verification to list twice, got %d list calls", f.lists)
+	}
+
+	if err := s.CleanUp(ch); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if len(f.visible()) != 0 {
+		t.Fatalf("expected record to be gone after CleanUp returned")
+	}
+	if f.lists != 6 {
+		t.Fatalf("expected verification to list twice, got %d list calls in total", f.lists)
+	}
+}
+
+func TestVerifyChangesNotConverged(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	f.frozen = true
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.VerifyChanges = &ChangeVerification{TimeoutSecs: 1, IntervalSecs: 1}
+	})
+
+	err := s.Present(ch)
+	if !errors.Is(err, ErrNotConverged) {
+		t.Fatalf("expected ErrNotConverged, got %v", err)
+	}
+	if f.creates != 1 {
+		t.Fatalf("expected one create, got %d", f.creates)
+	}
+}
+
+func TestVerifyChangesEndsAtPresentDeadline(t *testing.T) {
+	f := newFakeContabo(t, "example.com")
+	f.frozen = true
+	s, ch := newTestSolver(t, f, func(cfg *Config) {
+		cfg.VerifyChanges = &ChangeVerification{TimeoutSecs: maxVerifyTimeoutSecs, IntervalSecs: 1}
+	})
+	s.presentDeadline = time.Second
+
+	start := time.Now()
+	err := s.Present(ch)
+	if !errors.Is(err, ErrNotConverged) || !strings.Contains(err.Error(), "within 1s") {
+		t.Fatalf("expected verification to end at the present deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected Present to return by its deadline, took %s", elapsed)
+	}
+}
@@ -0,0 +1,293 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTokenFile is where Kubernetes mounts the service account token.
+	DefaultTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// DefaultAuthMount is the default mount path of the Kubernetes auth method.
+	DefaultAuthMount = "kubernetes"
+	// DefaultCacheTTL is how long KV secrets without a lease are cached.
+	DefaultCacheTTL = 5 * time.Minute
+)
+
+// Client reads KV v2 secrets from Vault, authenticating with the Kubernetes
+// auth method using the pod's service account token.
+type Client struct {
+	addr       string
+	role       string
+	authMount  string
+	tokenFile  string
+	cacheTTL   time.Duration
+	httpClient *http.Client
+	now        func() time.Time
+
+	// loginMu serialises logins, so that concurrent reads with an expired
+	// token log in once. mu guards the token and the cache only; no request
+	// is sent while it is held.
+	loginMu     sync.Mutex
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	secrets     map[string]cachedSecret
+}
+
+// Secret is the latest version of a KV v2 secret.
+type Secret struct {
+	// Data holds the string fields of the secret.
+	Data map[string]string
+	// CustomMetadata is the custom metadata of the secret, which is
+	// versioned separately from its data.
+	CustomMetadata map[string]string
+}
+
+type cachedSecret struct {
+	secret    *Secret
+	expiresAt time.Time
+}
+
+// Error is returned for non-2xx Vault responses.
+type Error struct {
+	Op         string
+	Path       string
+	StatusCode int
+	Errors     []string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("vault %s %s: status %d", e.Op, e.Path, e.StatusCode)
+	if len(e.Errors) > 0 {
+		msg += ": " + strings.Join(e.Errors, "; ")
+	}
+	return msg
+}
+
+func NewClient(addr, role, authMount, tokenFile string, cacheTTL, timeout time.Duration) (*Client, error) {
+	if addr == "" || role == "" {
+		return nil, errors.New("vault address and role are required")
+	}
+	if authMount == "" {
+		authMount = DefaultAuthMount
+	}
+	if tokenFile == "" {
+		tokenFile = DefaultTokenFile
+	}
+	if cacheTTL == 0 {
+		cacheTTL = DefaultCacheTTL
+	}
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+
+	return &Client{
+		addr:       strings.TrimSuffix(addr, "/"),
+		role:       role,
+		authMount:  strings.Trim(authMount, "/"),
+		tokenFile:  tokenFile,
+		cacheTTL:   cacheTTL,
+		httpClient: &http.Client{Timeout: timeout},
+		now:        time.Now,
+		secrets:    map[string]cachedSecret{},
+	}, nil
+}
+
+// ReadKV returns the latest version of a KV v2 secret. Results are cached for
+// the secret's lease duration, or the client's cache TTL when Vault doesn't
+// return a lease.
+func (c *Client) ReadKV(ctx context.Context, mount, path string) (*Secret, error) {
+	apiPath := fmt.Sprintf("%s/data/%s", strings.Trim(mount, "/"), strings.Trim(path, "/"))
+
+	c.mu.Lock()
+	cached, ok := c.secrets[apiPath]
+	c.mu.Unlock()
+	if ok && c.now().Before(cached.expiresAt) {
+		return cached.secret, nil
+	}
+
+	token, reused, err := c.ensureToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resp kvResponse
+	err = c.read(ctx, token, apiPath, &resp)
+	var vaultErr *Error
+	if reused && errors.As(err, &vaultErr) && vaultErr.StatusCode == http.StatusForbidden {
+		// The cached token may have been revoked before its lease ran out.
+		c.dropToken(token)
+		if token, _, err = c.ensureToken(ctx); err != nil {
+			return nil, err
+		}
+		err = c.read(ctx, token, apiPath, &resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data.Data == nil {
+		return nil, fmt.Errorf("vault read %s: secret has no data", apiPath)
+	}
+
+	secret := &Secret{
+		Data:           make(map[string]string, len(resp.Data.Data)),
+		CustomMetadata: resp.Data.Metadata.CustomMetadata,
+	}
+	for key, value := range resp.Data.Data {
+		if s, ok := value.(string); ok {
+			secret.Data[key] = s
+		}
+	}
+
+	ttl := c.cacheTTL
+	if resp.LeaseDuration > 0 {
+		ttl = time.Duration(resp.LeaseDuration) * time.Second
+	}
+	c.mu.Lock()
+	c.secrets[apiPath] = cachedSecret{secret: secret, expiresAt: c.now().Add(ttl)}
+	c.mu.Unlock()
+
+	return secret, nil
+}
+
+// read sends an authenticated GET request for path.
+func (c *Client) read(ctx context.Context, token, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.addr+"/v1/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	return c.send(req, "read", path, out)
+}
+
+// currentToken returns the token unless its lease ran out.
+func (c *Client) currentToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && c.now().Before(c.tokenExpiry) {
+		return c.token
+	}
+	return ""
+}
+
+// dropToken forgets token unless another read replaced it already.
+func (c *Client) dropToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+// ensureToken returns a token within its lease, logging in with the
+// Kubernetes auth method if there is none. reused reports whether the token
+// was issued before this call, and so may have been revoked since.
+func (c *Client) ensureToken(ctx context.Context) (token string, reused bool, err error) {
+	if token := c.currentToken(); token != "" {
+		return token, true, nil
+	}
+
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	// Another read may have logged in while this one waited.
+	if token := c.currentToken(); token != "" {
+		return token, false, nil
+	}
+	token, expiry, err := c.login(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	c.mu.Lock()
+	c.token = token
+	c.tokenExpiry = expiry
+	c.mu.Unlock()
+	return token, false, nil
+}
+
+// login logs in with the Kubernetes auth method and returns the token and
+// when to replace it.
+func (c *Client) login(ctx context.Context) (string, time.Time, error) {
+	jwt, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("vault login: failed to read service account token: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{"role": c.role, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	path := fmt.Sprintf("auth/%s/login", c.authMount)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.addr+"/v1/"+path, bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp loginResponse
+	if err := c.send(req, "login", path, &resp); err != nil {
+		return "", time.Time{}, err
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", time.Time{}, fmt.Errorf("vault login %s: response missing client_token", path)
+	}
+
+	lease := time.Duration(resp.Auth.LeaseDuration) * time.Second
+	if lease <= 0 {
+		// Tokens without a lease don't expire; still re-login periodically.
+		lease = c.cacheTTL
+	}
+	// Re-login before the lease runs out rather than failing a request with
+	// an expired token.
+	margin := min(lease/10, 30*time.Second)
+	return resp.Auth.ClientToken, c.now().Add(lease - margin), nil
+}
+
+func (c *Client) send(req *http.Request, op, path string, out any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault %s %s: %w", op, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var errResp errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		return &Error{Op: op, Path: path, StatusCode: resp.StatusCode, Errors: errResp.Errors}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("vault %s %s: failed to decode response: %w", op, path, err)
+	}
+	return nil
+}
+
+type loginResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+type kvResponse struct {
+	LeaseDuration int `json:"lease_duration"`
+	Data          struct {
+		Data     map[string]any `json:"data"`
+		Metadata struct {
+			CustomMetadata map[string]string `json:"custom_metadata"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+type errorResponse struct {
+	Errors []string `json:"errors"`
+}
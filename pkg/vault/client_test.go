@@ -0,0 +1,194 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeVault struct {
+	logins int
+	reads  int
+	revoke bool
+
+	// slowEntered is closed once a read of the slow secret arrives, which
+	// is answered when slowRelease is closed.
+	slowEntered chan struct{}
+	slowRelease chan struct{}
+}
+
+func (f *fakeVault) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/kubernetes/login", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Role string `json:"role"`
+			JWT  string `json:"jwt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode login: %v", err)
+		}
+		if req.Role != "webhook" || req.JWT != "sa-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid role or jwt"]}`))
+			return
+		}
+		f.logins++
+		f.revoke = false
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"vault-token","lease_duration":3600}}`))
+	})
+	mux.HandleFunc("/v1/secret/data/contabo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" || f.revoke {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		f.reads++
+		_, _ = w.Write([]byte(`{"data":{"data":{"clientId":"id","password":"pass","version":3},"metadata":{"version":1,"custom_metadata":{"team":"a"}}}}`))
+	})
+	mux.HandleFunc("/v1/secret/data/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(f.slowEntered)
+		<-f.slowRelease
+		_, _ = w.Write([]byte(`{"data":{"data":{"clientId":"slow"}}}`))
+	})
+	mux.HandleFunc("/v1/secret/data/forbidden", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+	})
+	return mux
+}
+
+func newTestClient(t *testing.T, f *fakeVault) (*Client, *time.Time) {
+	server := httptest.NewServer(f.handler(t))
+	t.Cleanup(server.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+
+	client, err := NewClient(server.URL, "webhook", "", tokenFile, time.Minute, 5*time.Second)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	now := time.Now()
+	client.now = func() time.Time { return now }
+	return client, &now
+}
+
+func TestReadKVCachesSecretAndToken(t *testing.T) {
+	f := &fakeVault{}
+	client, now := newTestClient(t, f)
+	ctx := context.Background()
+
+	secret, err := client.ReadKV(ctx, "secret", "contabo")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if secret.Data["clientId"] != "id" || secret.Data["password"] != "pass" || secret.CustomMetadata["team"] != "a" {
+		t.Fatalf("unexpected secret: %+v", secret)
+	}
+	if _, ok := secret.Data["version"]; ok {
+		t.Fatalf("expected non-string fields to be dropped: %v", secret.Data)
+	}
+
+	if _, err := client.ReadKV(ctx, "secret", "contabo"); err != nil {
+		t.Fatalf("cached read: %v", err)
+	}
+	if f.logins != 1 || f.reads != 1 {
+		t.Fatalf("expected cached read, got logins=%d reads=%d", f.logins, f.reads)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if _, err := client.ReadKV(ctx, "secret", "contabo"); err != nil {
+		t.Fatalf("read after cache expiry: %v", err)
+	}
+	if f.logins != 1 || f.reads != 2 {
+		t.Fatalf("expected re-read with cached token, got logins=%d reads=%d", f.logins, f.reads)
+	}
+
+	*now = now.Add(2 * time.Hour)
+	if _, err := client.ReadKV(ctx, "secret", "contabo"); err != nil {
+		t.Fatalf("read after token expiry: %v", err)
+	}
+	if f.logins != 2 {
+		t.Fatalf("expected re-login after token lease, got logins=%d", f.logins)
+	}
+}
+
+func TestReadKVRetriesRevokedToken(t *testing.T) {
+	f := &fakeVault{}
+	client, now := newTestClient(t, f)
+	ctx := context.Background()
+
+	if _, err := client.ReadKV(ctx, "secret", "contabo"); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	f.revoke = true
+	*now = now.Add(2 * time.Minute)
+	if _, err := client.ReadKV(ctx, "secret", "contabo"); err != nil {
+		t.Fatalf("read with revoked token: %v", err)
+	}
+	if f.logins != 2 {
+		t.Fatalf("expected re-login after 403, got logins=%d", f.logins)
+	}
+}
+
+func TestReadKVServesCacheDuringSlowReads(t *testing.T) {
+	f := &fakeVault{slowEntered: make(chan struct{}), slowRelease: make(chan struct{})}
+	client, _ := newTestClient(t, f)
+	ctx := context.Background()
+
+	if _, err := client.ReadKV(ctx, "secret", "contabo"); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := client.ReadKV(ctx, "secret", "slow")
+		slowDone <- err
+	}()
+	<-f.slowEntered
+
+	cachedDone := make(chan error, 1)
+	go func() {
+		_, err := client.ReadKV(ctx, "secret", "contabo")
+		cachedDone <- err
+	}()
+	select {
+	case err := <-cachedDone:
+		if err != nil {
+			t.Fatalf("cached read: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("cached read blocked behind a slow read")
+	}
+
+	close(f.slowRelease)
+	if err := <-slowDone; err != nil {
+		t.Fatalf("slow read: %v", err)
+	}
+}
+
+func TestReadKVErrors(t *testing.T) {
+	f := &fakeVault{}
+	client, _ := newTestClient(t, f)
+
+	_, err := client.ReadKV(context.Background(), "secret", "forbidden")
+	var vaultErr *Error
+	if !errors.As(err, &vaultErr) || vaultErr.StatusCode != http.StatusForbidden || vaultErr.Path != "secret/data/forbidden" {
+		t.Fatalf("expected 403 vault error, got %v", err)
+	}
+
+	client.role = "other"
+	client.token = ""
+	_, err = client.ReadKV(context.Background(), "secret", "contabo")
+	if !errors.As(err, &vaultErr) || vaultErr.Op != "login" {
+		t.Fatalf("expected login error, got %v", err)
+	}
+}